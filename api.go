@@ -36,8 +36,44 @@ type Chiper interface {
 	io.Closer
 	Info() ChipInfo
 	LineInfo(line uint32) (LineInfo, error)
+	Snapshot() ([]LineState, error)
 	OpenLines(flag RequestFlag, consumerLabel string, lines ...uint32) (Lineser, error)
+	OpenLinesWith(flag RequestFlag, consumerLabel string, opt LineOptions, lines ...uint32) (Lineser, error)
+	OpenLinesByName(flag RequestFlag, consumerLabel string, names ...string) (Lineser, error)
+	FindLines(names ...string) ([]uint32, error)
 	GetLineEvent(line uint32, flag RequestFlag, events EventFlag, consumerLabel string) (Eventer, error)
+	GetLineEventWith(line uint32, flag RequestFlag, events EventFlag, consumerLabel string, opt EventOptions) (Eventer, error)
+	GetLinesEvent(lines []uint32, flag RequestFlag, events EventFlag, consumerLabel string, opt EventOptions) (Eventer, error)
+	WatchLineInfo(lines ...uint32) (LineWatcher, error)
+}
+
+// Optional parameters to Chiper.OpenLinesWith.
+// Zero value means same as plain OpenLines.
+type LineOptions struct {
+	// Initial output values in the same order as line offsets.
+	// Missing tail is low. Ignored for inputs.
+	DefaultValues []byte
+
+	// Inputs only, v2 ABI only. Kernel reports new value only after line
+	// was stable for this period. Microsecond resolution.
+	Debounce time.Duration
+}
+
+// Optional parameters to Chiper.GetLineEventWith.
+// Zero value means same as plain GetLineEvent.
+type EventOptions struct {
+	// Edge is reported only after line was stable for this period.
+	// Microsecond resolution. Uses kernel debounce with v2 ABI,
+	// emulated in Eventer.Wait with v1 ABI.
+	Debounce time.Duration
+
+	// Source of Event.Timestamp, v1 ABI supports only monotonic.
+	Clock EventClock
+
+	// Suggested kernel event buffer size, v2 ABI only. 0 means default
+	// 16 per line. Kernel rounds up to power of 2 and caps at 1024.
+	// v1 ABI has fixed 16. Actual size is reported by Eventer.BufferSize().
+	BufferSize uint32
 }
 
 type LineSetFunc func(value byte)
@@ -49,12 +85,45 @@ type Lineser interface {
 	Read() (HandleData, error)
 	Flush() error
 	SetBulk(bs ...byte)
+	SetConfig(flag RequestFlag, defaultValues ...byte) error
+	GetValues(mask uint64) (uint64, error)
+	SetValues(mask, bits uint64) error
 }
 
 type Eventer interface {
 	io.Closer
 	Read() (byte, error)
-	Wait(timeout time.Duration) (EventData, error)
+	Wait(timeout time.Duration) (Event, error)
+	Dropped() uint64
+	BufferSize() uint32
+}
+
+// Edge event returned by Eventer.Wait, same for v1 and v2 ABI.
+// Kernel record is embedded as is, other fields are filled by library.
+type Event struct {
+	EventData
+
+	// clock of Timestamp as requested in EventOptions.Clock,
+	// use Time() to convert
+	Clock EventClock
+
+	// sequence number of this event among all lines of request, starts at 1.
+	// From kernel with v2 ABI, counted by library with v1 ABI.
+	Seqno uint32
+
+	// sequence number of this event on this particular line
+	LineSeqno uint32
+
+	// the line that triggered the event, see Chiper.GetLinesEvent
+	LineOffset uint32
+}
+
+// Stream of line info changes, see Chiper.WatchLineInfo.
+type LineWatcher interface {
+	io.Closer
+	Watch(line uint32) (LineInfo, error)
+	Unwatch(line uint32) error
+	Wait(timeout time.Duration) (LineInfoChanged, error)
 }
 
 // compile-time interface check
@@ -0,0 +1,67 @@
+package gpio
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+type EventClock uint32
+
+const (
+	// CLOCK_MONOTONIC, kernel default
+	EventClockMonotonic EventClock = iota
+	// CLOCK_REALTIME, v2 ABI, Linux 5.11+
+	EventClockRealtime
+	// Hardware timestamp engine, v2 ABI, Linux 6.0+
+	// Providers use timebase compatible with CLOCK_MONOTONIC.
+	EventClockHTE
+)
+
+func (c EventClock) String() string {
+	switch c {
+	case EventClockMonotonic:
+		return "monotonic"
+	case EventClockRealtime:
+		return "realtime"
+	case EventClockHTE:
+		return "hte"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(c))
+}
+
+func (c EventClock) V2() LineFlagV2 {
+	switch c {
+	case EventClockRealtime:
+		return GPIO_V2_LINE_FLAG_EVENT_CLOCK_REALTIME
+	case EventClockHTE:
+		return GPIO_V2_LINE_FLAG_EVENT_CLOCK_HTE
+	}
+	return 0
+}
+
+// Converts Timestamp to wall clock time according to Clock.
+// Monotonic timestamps are converted relative to current time, so result
+// shifts if wall clock was stepped between event and this call.
+func (e *Event) Time() time.Time {
+	if e.Clock == EventClockRealtime {
+		return time.Unix(0, int64(e.Timestamp))
+	}
+	now := time.Now()
+	ago := time.Duration(int64(MonotonicNow() - e.Timestamp))
+	return now.Add(-ago)
+}
+
+// Kernel event timestamps are CLOCK_MONOTONIC nanoseconds by default,
+// which Go runtime doesn't expose. Use to compare with Event.Timestamp.
+func MonotonicNow() uint64 {
+	var ts syscall.Timespec
+	_, _, errno := syscall.RawSyscall(syscall.SYS_CLOCK_GETTIME, clockMonotonic, uintptr(unsafe.Pointer(&ts)), 0)
+	if errno != 0 {
+		panic("code error clock_gettime(CLOCK_MONOTONIC) errno=" + errno.Error())
+	}
+	return uint64(ts.Nano())
+}
+
+const clockMonotonic = 1
@@ -0,0 +1,80 @@
+// Exports line values and edge counters for Prometheus, see package exporter.
+// Lines are offsets or names, see gpio.FindLine.
+// Usage:
+//
+//	gpio-exporter [-chip ID] [-listen :9573] [-interval 1s] [-line LINE]... [-count LINE]...
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+	"github.com/temoto/gpio-cdev-go/cmd/internal/cliutil"
+	"github.com/temoto/gpio-cdev-go/exporter"
+)
+
+type config struct {
+	chipID   string
+	listen   string
+	sampled  cliutil.StringList
+	counted  cliutil.StringList
+	flag     gpio.RequestFlag
+	debounce time.Duration
+	exporter exporter.Config
+}
+
+func wrapped(cfg config) error {
+	specs := append(append([]string(nil), cfg.sampled...), cfg.counted...)
+	chip, offsets, err := cliutil.OpenLines(cfg.chipID, "gpio-exporter", specs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer chip.Close()
+	for i, offset := range offsets {
+		l := exporter.Line{Line: offset, Flag: cfg.flag}
+		if i >= len(cfg.sampled) {
+			l.Count, l.Debounce = true, cfg.debounce
+		}
+		cfg.exporter.Lines = append(cfg.exporter.Lines, l)
+	}
+
+	e, err := exporter.New(chip, cfg.exporter)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer e.Close()
+	http.Handle("/metrics", e)
+	log.Printf("listening on %s", cfg.listen)
+	return errors.Trace(http.ListenAndServe(cfg.listen, nil))
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg := config{}
+	cmdline.StringVar(&cfg.chipID, "chip", "", "label, name, device or sysfs path, default "+cliutil.DefaultChip+" or chip of named lines")
+	cmdline.StringVar(&cfg.listen, "listen", ":9573", "HTTP listen address, metrics at /metrics")
+	cmdline.DurationVar(&cfg.exporter.Interval, "interval", time.Second, "sampling period")
+	cmdline.Var(&cfg.sampled, "line", "sampled LINE, repeat for more")
+	cmdline.Var(&cfg.counted, "count", "LINE to count edges, repeat for more")
+	bias := cmdline.String("bias", "", "as-is|pull-up|pull-down|disabled")
+	activeLow := cmdline.Bool("active-low", false, "invert values")
+	cmdline.DurationVar(&cfg.debounce, "debounce", 0, "counted lines debounce period")
+	_ = cmdline.Parse(os.Args[1:])
+
+	var err error
+	if cfg.flag, err = cliutil.ParseBias(*bias); err != nil {
+		log.Fatal(err)
+	}
+	if *activeLow {
+		cfg.flag |= gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW
+	}
+	if err = wrapped(cfg); err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+}
@@ -0,0 +1,67 @@
+// Reads lines once and prints values, like gpioget from libgpiod.
+// Lines are offsets or names, see gpio.FindLine.
+// Usage:
+//
+//	gpio-get [-chip ID] [-active-low] [-bias pull-up] LINE...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+	"github.com/temoto/gpio-cdev-go/cmd/internal/cliutil"
+)
+
+func wrapped(chipID string, reqFlag gpio.RequestFlag, verbose bool, specs []string) error {
+	chip, offsets, err := cliutil.OpenLines(chipID, "gpio-get", specs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer chip.Close()
+	lines, err := chip.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT|reqFlag, "", offsets...)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer lines.Close()
+	data, err := lines.Read()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	out := make([]string, len(specs))
+	for i, spec := range specs {
+		if verbose {
+			out[i] = fmt.Sprintf("%s=%d", spec, data.Values[i])
+		} else {
+			out[i] = fmt.Sprintf("%d", data.Values[i])
+		}
+	}
+	fmt.Println(strings.Join(out, " "))
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	chipID := cmdline.String("chip", "", "label, name, device or sysfs path, default "+cliutil.DefaultChip+" or chip of named lines")
+	activeLow := cmdline.Bool("active-low", false, "invert values")
+	bias := cmdline.String("bias", "", "as-is|pull-up|pull-down|disabled")
+	verbose := cmdline.Bool("v", false, "print LINE=VALUE")
+	_ = cmdline.Parse(os.Args[1:])
+
+	reqFlag, err := cliutil.ParseBias(*bias)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *activeLow {
+		reqFlag |= gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW
+	}
+	if err = wrapped(*chipID, reqFlag, *verbose, cmdline.Args()); err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+}
@@ -0,0 +1,95 @@
+// Serves GPIO chips over HTTP/JSON, see package httpapi for endpoints.
+// Daemon owns all requested lines, clients never open /dev/gpiochip.
+// Usage:
+//
+//	gpio-httpd [-listen localhost:8080] [-chip ID]...
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+	"github.com/temoto/gpio-cdev-go/cmd/internal/cliutil"
+	"github.com/temoto/gpio-cdev-go/httpapi"
+)
+
+const consumer = "gpio-httpd"
+
+func wrapped(listen string, chipIDs []string) error {
+	if len(chipIDs) == 0 {
+		found, err := gpio.ListChips()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, c := range found {
+			if c.Err != nil {
+				log.Printf("skip chip: %v", c.Err)
+				continue
+			}
+			chipIDs = append(chipIDs, c.Path)
+		}
+	}
+	if len(chipIDs) == 0 {
+		return errors.NotFoundf("GPIO chips")
+	}
+	chips := make([]gpio.Chiper, 0, len(chipIDs))
+	defer func() {
+		for _, c := range chips {
+			c.Close()
+		}
+	}()
+	for _, id := range chipIDs {
+		c, err := gpio.OpenChip(id, consumer)
+		if err != nil {
+			return errors.Annotatef(err, "chip=%s", id)
+		}
+		chips = append(chips, c)
+	}
+
+	api := httpapi.NewServer(consumer, chips...)
+	defer api.Close()
+	srv := &http.Server{Addr: listen, Handler: api}
+	errch := make(chan error, 1)
+	go func() { errch <- srv.ListenAndServe() }()
+	log.Printf("listening on %s", listen)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errch:
+		return errors.Trace(err)
+	case <-stop:
+	}
+	// event streams never end by themselves, so don't wait long
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		_ = srv.Close()
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	listen := cmdline.String("listen", "localhost:8080", "HTTP listen address")
+	var chipIDs cliutil.StringList
+	cmdline.Var(&chipIDs, "chip", "label, name, device or sysfs path, repeat for more chips, default all chips")
+	_ = cmdline.Parse(os.Args[1:])
+	if cmdline.NArg() != 0 {
+		log.Fatalf("unexpected arguments: %s", strings.Join(cmdline.Args(), " "))
+	}
+
+	if err := wrapped(*listen, chipIDs); err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+}
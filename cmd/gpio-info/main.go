@@ -0,0 +1,135 @@
+// Lists GPIO chips and their lines, like gpiodetect and gpioinfo from libgpiod.
+// Usage:
+//
+//	gpio-info                 all chips with all lines
+//	gpio-info -detect         chips only
+//	gpio-info -chip LABEL     one chip by label, name or path, see gpio.FindChip
+//	gpio-info -json           machine readable output
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+type chipReport struct {
+	Path      string           `json:"path"`
+	SysfsPath string           `json:"sysfs_path,omitempty"`
+	Name      string           `json:"name"`
+	Label     string           `json:"label"`
+	Lines     uint32           `json:"lines"`
+	LineInfo  []gpio.LineState `json:"line_info,omitempty"`
+	// chip could not be read, other chips are still reported
+	Error string `json:"error,omitempty"`
+}
+
+func collect(chipID string, detect bool) ([]chipReport, error) {
+	var chips []gpio.ChipEntry
+	if chipID != "" {
+		c, err := gpio.FindChip(chipID)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		chips = append(chips, c)
+	} else {
+		var err error
+		if chips, err = gpio.ListChips(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	reports := make([]chipReport, 0, len(chips))
+	for _, c := range chips {
+		r := chipReport{
+			Path:      c.Path,
+			SysfsPath: c.SysfsPath,
+			Name:      c.Name(),
+			Label:     c.Label(),
+			Lines:     c.Info.Lines,
+		}
+		if c.Err != nil {
+			r.Error = c.Err.Error()
+		} else if !detect {
+			var err error
+			if r.LineInfo, err = snapshot(c.Path); err != nil {
+				// like EACCES or chip removed meanwhile, other chips are still listed
+				log.Printf("chip path=%s: %v", c.Path, err)
+				r.Error = err.Error()
+			}
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+func snapshot(path string) ([]gpio.LineState, error) {
+	chip, err := gpio.Open(path, "gpio-info")
+	if err != nil {
+		return nil, err
+	}
+	defer chip.Close()
+	return chip.Snapshot()
+}
+
+func printTable(w io.Writer, reports []chipReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range reports {
+		if r.Error != "" {
+			fmt.Fprintf(tw, "%s error: %s\n", r.Path, r.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "%s [%s] (%d lines) %s\n", r.Name, r.Label, r.Lines, r.Path)
+		for _, l := range r.LineInfo {
+			name, consumer := quoted(l.Name, "unnamed"), quoted(l.Consumer, "unused")
+			if l.Used && l.Consumer == "" {
+				consumer = "kernel"
+			}
+			polarity := "active-high"
+			if l.ActiveLow {
+				polarity = "active-low"
+			}
+			fmt.Fprintf(tw, "\tline %3d:\t%s\t%s\t%s\t%s\t%s\tbias=%s\n",
+				l.Offset, name, consumer, l.Direction, polarity, l.Drive, l.Bias)
+		}
+	}
+	return tw.Flush()
+}
+
+func quoted(s, empty string) string {
+	if s == "" {
+		return empty
+	}
+	return fmt.Sprintf("%q", s)
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	chipID := cmdline.String("chip", "", "only this chip: label, name, device or sysfs path")
+	detect := cmdline.Bool("detect", false, "list chips only, like gpiodetect")
+	asJSON := cmdline.Bool("json", false, "print JSON instead of table")
+	_ = cmdline.Parse(os.Args[1:])
+
+	reports, err := collect(*chipID, *detect)
+	if err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(reports)
+	} else {
+		err = printTable(os.Stdout, reports)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+// Serves lines over Modbus TCP, see package modbus for mapping.
+// Lines are offsets or names, see gpio.FindLine.
+// Usage:
+//
+//	gpio-modbus [-chip ID] [-listen :502] [-coil ADDR=LINE[=INITIAL]]... [-input ADDR=LINE[=COUNTER_ADDR]]...
+//
+// Example, LED at coil 0, button at discrete input 0 with edge count
+// in input registers 0 and 1:
+//
+//	gpio-modbus -coil 0=LED -input 0=BUTTON=0
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+	"github.com/temoto/gpio-cdev-go/cmd/internal/cliutil"
+	"github.com/temoto/gpio-cdev-go/modbus"
+)
+
+type config struct {
+	chipID   string
+	listen   string
+	coils    cliutil.StringList
+	inputs   cliutil.StringList
+	inFlag   gpio.RequestFlag
+	debounce time.Duration
+	modbus   modbus.Config
+}
+
+// "ADDR=LINE[=EXTRA]" -> ADDR, LINE, EXTRA or -1
+func parseMapping(arg string) (uint16, string, int, error) {
+	parts := strings.Split(arg, "=")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, "", 0, errors.NotValidf("mapping=%s, expected ADDR=LINE[=VALUE]", arg)
+	}
+	addr, err := strconv.ParseUint(parts[0], 0, 16)
+	if err != nil {
+		return 0, "", 0, errors.NotValidf("mapping=%s address", arg)
+	}
+	extra := -1
+	if len(parts) == 3 {
+		n, err := strconv.ParseUint(parts[2], 0, 16)
+		if err != nil {
+			return 0, "", 0, errors.NotValidf("mapping=%s value", arg)
+		}
+		extra = int(n)
+	}
+	return uint16(addr), parts[1], extra, nil
+}
+
+func wrapped(cfg config) error {
+	var specs []string
+	for _, arg := range cfg.coils {
+		addr, spec, initial, err := parseMapping(arg)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if initial > 1 {
+			return errors.NotValidf("-coil=%s initial value, expected 0 or 1", arg)
+		}
+		c := modbus.Coil{Address: addr}
+		if initial == 1 {
+			c.Initial = 1
+		}
+		cfg.modbus.Coils = append(cfg.modbus.Coils, c)
+		specs = append(specs, spec)
+	}
+	for _, arg := range cfg.inputs {
+		addr, spec, counter, err := parseMapping(arg)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		in := modbus.Input{Address: addr, Flag: cfg.inFlag, Debounce: cfg.debounce}
+		if counter >= 0 {
+			in.Counter, in.CounterAddress = true, uint16(counter)
+		}
+		cfg.modbus.Inputs = append(cfg.modbus.Inputs, in)
+		specs = append(specs, spec)
+	}
+
+	chip, offsets, err := cliutil.OpenLines(cfg.chipID, "gpio-modbus", specs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer chip.Close()
+	for i := range cfg.modbus.Coils {
+		cfg.modbus.Coils[i].Line = offsets[i]
+	}
+	for i := range cfg.modbus.Inputs {
+		cfg.modbus.Inputs[i].Line = offsets[len(cfg.modbus.Coils)+i]
+	}
+
+	s, err := modbus.New(chip, cfg.modbus)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer s.Close()
+	l, err := net.Listen("tcp", cfg.listen)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer l.Close()
+	log.Printf("listening on %s", l.Addr())
+
+	errch := make(chan error, 1)
+	go func() { errch <- s.Serve(l) }()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-errch:
+		return errors.Trace(err)
+	case <-stop:
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg := config{}
+	cmdline.StringVar(&cfg.chipID, "chip", "", "label, name, device or sysfs path, default "+cliutil.DefaultChip+" or chip of named lines")
+	cmdline.StringVar(&cfg.listen, "listen", ":502", "Modbus TCP listen address")
+	cmdline.Var(&cfg.coils, "coil", "output ADDR=LINE or ADDR=LINE=INITIAL, repeat for more")
+	cmdline.Var(&cfg.inputs, "input", "input ADDR=LINE or ADDR=LINE=COUNTER_ADDR, repeat for more")
+	bias := cmdline.String("bias", "", "inputs bias as-is|pull-up|pull-down|disabled")
+	cmdline.DurationVar(&cfg.debounce, "debounce", 0, "inputs debounce period")
+	unitID := cmdline.Uint("unit", 0, "accept only this unit id, 0 = any")
+	_ = cmdline.Parse(os.Args[1:])
+	cfg.modbus.UnitID = byte(*unitID)
+
+	var err error
+	if cfg.inFlag, err = cliutil.ParseBias(*bias); err != nil {
+		log.Fatal(err)
+	}
+	if err = wrapped(cfg); err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+}
@@ -0,0 +1,240 @@
+// Prints edge events on lines as they arrive, like gpiomon from libgpiod.
+// Lines are offsets or names, see gpio.FindLine.
+// With v2 ABI, Linux 5.10+, events of all lines come in kernel order.
+// Usage:
+//
+//	gpio-mon [-chip ID] [-edge both] [-num N] [-timeout D] [-format FMT | -json] LINE...
+//
+// Format placeholders:
+//
+//	%o line offset    %l line as given in arguments
+//	%e 1 rising, 0 falling    %E "rising" or "falling"
+//	%s seconds.nanoseconds of event clock    %t wall time RFC3339Nano
+//	%q sequence number    %%  literal %
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+	"github.com/temoto/gpio-cdev-go/cmd/internal/cliutil"
+)
+
+type config struct {
+	chipID   string
+	reqFlag  gpio.RequestFlag
+	events   gpio.EventFlag
+	opt      gpio.EventOptions
+	num      int
+	timeout  time.Duration
+	format   string
+	jsonLine bool
+}
+
+type event struct {
+	spec string
+	data gpio.Event
+}
+
+type jsonEvent struct {
+	Line      string    `json:"line"`
+	Offset    uint32    `json:"offset"`
+	Edge      string    `json:"edge"`
+	Timestamp uint64    `json:"timestamp_ns"`
+	Time      time.Time `json:"time"`
+	Seqno     uint32    `json:"seqno"`
+}
+
+func edgeName(id gpio.EventID) string {
+	if id == gpio.GPIOEVENT_EVENT_RISING_EDGE {
+		return "rising"
+	}
+	return "falling"
+}
+
+func formatEvent(format string, ev event) string {
+	var b bytes.Buffer
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'o':
+			fmt.Fprintf(&b, "%d", ev.data.LineOffset)
+		case 'l':
+			b.WriteString(ev.spec)
+		case 'e':
+			if ev.data.ID == gpio.GPIOEVENT_EVENT_RISING_EDGE {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		case 'E':
+			b.WriteString(edgeName(ev.data.ID))
+		case 's':
+			fmt.Fprintf(&b, "%d.%09d", ev.data.Timestamp/1e9, ev.data.Timestamp%1e9)
+		case 't':
+			b.WriteString(ev.data.Time().Format(time.RFC3339Nano))
+		case 'q':
+			fmt.Fprintf(&b, "%d", ev.data.Seqno)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// Single request keeps events of all lines in kernel order, it requires
+// v2 ABI for more than one line. On v1 falls back to request per line.
+func openEvents(chip gpio.Chiper, cfg config, offsets []uint32, specs []string) ([]gpio.Eventer, error) {
+	ev, err := chip.GetLinesEvent(offsets, cfg.reqFlag, cfg.events, "", cfg.opt)
+	if err == nil {
+		return []gpio.Eventer{ev}, nil
+	}
+	if !errors.IsNotSupported(err) {
+		return nil, errors.Annotatef(err, "lines=%v", specs)
+	}
+	evs := make([]gpio.Eventer, 0, len(offsets))
+	for i, offset := range offsets {
+		ev, err := chip.GetLineEventWith(offset, cfg.reqFlag, cfg.events, "", cfg.opt)
+		if err != nil {
+			return evs, errors.Annotatef(err, "line=%s", specs[i])
+		}
+		evs = append(evs, ev)
+	}
+	return evs, nil
+}
+
+func wrapped(cfg config, specs []string) error {
+	chip, offsets, err := cliutil.OpenLines(cfg.chipID, "gpio-mon", specs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer chip.Close()
+	specOf := make(map[uint32]string, len(offsets))
+	for i, offset := range offsets {
+		specOf[offset] = specs[i]
+	}
+
+	evs, err := openEvents(chip, cfg, offsets, specs)
+	for _, ev := range evs {
+		defer ev.Close()
+	}
+	if err != nil {
+		return err
+	}
+	ch := make(chan gpio.Event)
+	errch := make(chan error, len(evs))
+	for _, ev := range evs {
+		go func(ev gpio.Eventer) {
+			for {
+				data, err := ev.Wait(0)
+				if err != nil {
+					errch <- err
+					return
+				}
+				ch <- data
+			}
+		}(ev)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	enc := json.NewEncoder(os.Stdout)
+	for n := 0; cfg.num == 0 || n < cfg.num; n++ {
+		var idle <-chan time.Time
+		if cfg.timeout != 0 {
+			idle = time.After(cfg.timeout)
+		}
+		var data gpio.Event
+		select {
+		case data = <-ch:
+		case err = <-errch:
+			return errors.Trace(err)
+		case <-idle:
+			return errors.Errorf("timeout, no events for %s", cfg.timeout)
+		case <-stop:
+			return nil
+		}
+		e := event{spec: specOf[data.LineOffset], data: data}
+		if cfg.jsonLine {
+			err = enc.Encode(jsonEvent{
+				Line:      e.spec,
+				Offset:    data.LineOffset,
+				Edge:      edgeName(data.ID),
+				Timestamp: data.Timestamp,
+				Time:      data.Time(),
+				Seqno:     data.Seqno,
+			})
+		} else {
+			_, err = os.Stdout.WriteString(formatEvent(cfg.format, e))
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var cfg config
+	cmdline.StringVar(&cfg.chipID, "chip", "", "label, name, device or sysfs path, default "+cliutil.DefaultChip+" or chip of named lines")
+	activeLow := cmdline.Bool("active-low", false, "invert values")
+	bias := cmdline.String("bias", "", "as-is|pull-up|pull-down|disabled")
+	edge := cmdline.String("edge", "both", "rising|falling|both")
+	clock := cmdline.String("clock", "monotonic", "monotonic|realtime|hte")
+	cmdline.DurationVar(&cfg.opt.Debounce, "debounce", 0, "debounce period")
+	cmdline.IntVar(&cfg.num, "num", 0, "exit after N events, 0 = never")
+	cmdline.DurationVar(&cfg.timeout, "timeout", 0, "fail if no event arrives within duration, 0 = wait forever")
+	cmdline.StringVar(&cfg.format, "format", "%s %E %l", "output template, see package doc")
+	cmdline.BoolVar(&cfg.jsonLine, "json", false, "print JSON object per line")
+	_ = cmdline.Parse(os.Args[1:])
+
+	var err error
+	if cfg.reqFlag, err = cliutil.ParseBias(*bias); err != nil {
+		log.Fatal(err)
+	}
+	if *activeLow {
+		cfg.reqFlag |= gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW
+	}
+	switch *edge {
+	case "rising":
+		cfg.events = gpio.GPIOEVENT_REQUEST_RISING_EDGE
+	case "falling":
+		cfg.events = gpio.GPIOEVENT_REQUEST_FALLING_EDGE
+	case "both":
+		cfg.events = gpio.GPIOEVENT_REQUEST_BOTH_EDGES
+	default:
+		log.Fatalf("invalid edge=%s", *edge)
+	}
+	switch *clock {
+	case "monotonic":
+	case "realtime":
+		cfg.opt.Clock = gpio.EventClockRealtime
+	case "hte":
+		cfg.opt.Clock = gpio.EventClockHTE
+	default:
+		log.Fatalf("invalid clock=%s", *clock)
+	}
+	if err = wrapped(cfg, cmdline.Args()); err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+}
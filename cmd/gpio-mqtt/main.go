@@ -0,0 +1,133 @@
+// Bridges lines to MQTT broker, see package mqttbridge for topics.
+// Lines are offsets or names, see gpio.FindLine.
+// Password is read from MQTT_PASSWORD environment variable.
+// With -discovery, lines appear in Home Assistant, CLASS of input is
+// binary_sensor device_class like "door" or "motion".
+// Usage:
+//
+//	gpio-mqtt -broker HOST:PORT [-chip ID] [-prefix gpio/CHIP] [-discovery homeassistant]
+//	          [-in LINE[:CLASS]]... [-out LINE[=INITIAL]]...
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+	"github.com/temoto/gpio-cdev-go/cmd/internal/cliutil"
+	"github.com/temoto/gpio-cdev-go/mqttbridge"
+)
+
+type config struct {
+	chipID   string
+	bridge   mqttbridge.Config
+	ins      cliutil.StringList
+	outs     cliutil.StringList
+	inFlag   gpio.RequestFlag
+	debounce time.Duration
+	retry    time.Duration
+}
+
+func wrapped(cfg config) error {
+	specs := make([]string, len(cfg.ins))
+	classes := make([]string, len(cfg.ins))
+	for i, in := range cfg.ins {
+		parts := strings.SplitN(in, ":", 2)
+		specs[i] = parts[0]
+		if len(parts) == 2 {
+			classes[i] = parts[1]
+		}
+	}
+	initial := make([]byte, len(cfg.outs))
+	for i, out := range cfg.outs {
+		parts := strings.SplitN(out, "=", 2)
+		if len(parts) == 2 {
+			v, err := strconv.ParseUint(parts[1], 10, 1)
+			if err != nil {
+				return errors.NotValidf("-out=%s value, expected 0 or 1", out)
+			}
+			initial[i] = byte(v)
+		}
+		specs = append(specs, parts[0])
+	}
+	chip, offsets, err := cliutil.OpenLines(cfg.chipID, "gpio-mqtt", specs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer chip.Close()
+	for i, offset := range offsets {
+		var p mqttbridge.Pin
+		if i < len(cfg.ins) {
+			p = mqttbridge.Pin{Line: offset, Flag: cfg.inFlag, Debounce: cfg.debounce, DeviceClass: classes[i]}
+		} else {
+			p = mqttbridge.Pin{Line: offset, Output: true, Initial: initial[i-len(cfg.ins)]}
+		}
+		cfg.bridge.Pins = append(cfg.bridge.Pins, p)
+	}
+
+	b, err := mqttbridge.New(chip, cfg.bridge)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer b.Close()
+
+	stop := make(chan struct{})
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigch
+		close(stop)
+	}()
+	for {
+		err = b.Run(stop)
+		if err == nil {
+			return nil
+		}
+		log.Printf("%v, reconnect in %s", err, cfg.retry)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(cfg.retry):
+		}
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg := config{}
+	cmdline.StringVar(&cfg.chipID, "chip", "", "label, name, device or sysfs path, default "+cliutil.DefaultChip+" or chip of named lines")
+	cmdline.StringVar(&cfg.bridge.Broker, "broker", "localhost:1883", "MQTT broker address")
+	cmdline.StringVar(&cfg.bridge.ClientID, "id", "", "MQTT client id, default gpio-CHIP")
+	cmdline.StringVar(&cfg.bridge.Username, "user", "", "MQTT username")
+	cmdline.StringVar(&cfg.bridge.Prefix, "prefix", "", "topic prefix, default gpio/CHIP")
+	cmdline.StringVar(&cfg.bridge.Topics.State, "topic-state", mqttbridge.DefaultTopics.State, "state topic template")
+	cmdline.StringVar(&cfg.bridge.Topics.Edge, "topic-edge", mqttbridge.DefaultTopics.Edge, "edge topic template")
+	cmdline.StringVar(&cfg.bridge.Topics.Count, "topic-count", mqttbridge.DefaultTopics.Count, "edge count topic template")
+	cmdline.StringVar(&cfg.bridge.Topics.Command, "topic-command", mqttbridge.DefaultTopics.Command, "command topic template")
+	cmdline.StringVar(&cfg.bridge.Topics.Availability, "topic-status", mqttbridge.DefaultTopics.Availability, "availability topic template")
+	cmdline.StringVar(&cfg.bridge.Discovery.Prefix, "discovery", "", "Home Assistant discovery prefix, usually homeassistant, empty to disable")
+	cmdline.StringVar(&cfg.bridge.Discovery.DeviceName, "device-name", "", "Home Assistant device name, default chip label")
+	cmdline.Var(&cfg.ins, "in", "input LINE or LINE:CLASS, repeat for more")
+	cmdline.Var(&cfg.outs, "out", "output LINE or LINE=INITIAL, repeat for more")
+	bias := cmdline.String("bias", "", "inputs bias as-is|pull-up|pull-down|disabled")
+	cmdline.DurationVar(&cfg.debounce, "debounce", 0, "inputs debounce period")
+	cmdline.DurationVar(&cfg.retry, "retry", 5*time.Second, "reconnect delay")
+	_ = cmdline.Parse(os.Args[1:])
+	cfg.bridge.Password = os.Getenv("MQTT_PASSWORD")
+
+	var err error
+	if cfg.inFlag, err = cliutil.ParseBias(*bias); err != nil {
+		log.Fatal(err)
+	}
+	if err = wrapped(cfg); err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+}
@@ -0,0 +1,68 @@
+// Exports local chip over network for remote.Dial.
+// There is no authentication, default address is loopback only,
+// use -listen :7340 to accept connections from other hosts.
+// Usage:
+//
+//	gpio-remoted [-chip ID] [-listen 127.0.0.1:7340 | -unix /run/gpio.sock]
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+	"github.com/temoto/gpio-cdev-go/cmd/internal/cliutil"
+	"github.com/temoto/gpio-cdev-go/remote"
+)
+
+func wrapped(chipID, network, address string) error {
+	chip, err := gpio.OpenChip(chipID, "gpio-remoted")
+	if err != nil {
+		return errors.Annotatef(err, "chip=%s", chipID)
+	}
+	defer chip.Close()
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// unix socket file is removed by Close
+	defer l.Close()
+	log.Printf("serving chip=%s on %s %s", chipID, network, l.Addr())
+
+	srv := remote.NewServer(chip)
+	// runs before chip.Close, which waits for lines held by clients
+	defer srv.Close()
+	errch := make(chan error, 1)
+	go func() { errch <- srv.Serve(l) }()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-errch:
+		return errors.Trace(err)
+	case <-stop:
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	chipID := cmdline.String("chip", cliutil.DefaultChip, "label, name, device or sysfs path")
+	listen := cmdline.String("listen", "127.0.0.1:"+remote.DefaultPort, "TCP listen address, :"+remote.DefaultPort+" exposes chip on all interfaces")
+	unixPath := cmdline.String("unix", "", "listen on Unix socket path instead of TCP")
+	_ = cmdline.Parse(os.Args[1:])
+
+	network, address := "tcp", *listen
+	if *unixPath != "" {
+		network, address = "unix", *unixPath
+	}
+	if err := wrapped(*chipID, network, address); err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+}
@@ -0,0 +1,154 @@
+// Drives lines to given values, like gpioset from libgpiod.
+// Lines are offsets or names, see gpio.FindLine.
+// Usage:
+//
+//	gpio-set [-chip ID] [-mode exit|signal|time|toggle] LINE=VALUE...
+//
+// Modes:
+//
+//	exit    set and exit immediately, kernel may revert lines after release
+//	signal  hold lines until SIGINT or SIGTERM
+//	time    hold lines for -hold duration
+//	toggle  invert all lines every -period until SIGINT or SIGTERM
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+	"github.com/temoto/gpio-cdev-go/cmd/internal/cliutil"
+)
+
+type config struct {
+	chipID  string
+	reqFlag gpio.RequestFlag
+	mode    string
+	hold    time.Duration
+	period  time.Duration
+}
+
+// "NAME=1" -> "NAME", 1
+func parseAssignments(args []string) ([]string, []byte, error) {
+	specs := make([]string, len(args))
+	values := make([]byte, len(args))
+	for i, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, errors.NotValidf("argument=%s, expected LINE=VALUE", arg)
+		}
+		v, err := strconv.ParseUint(parts[1], 10, 1)
+		if err != nil {
+			return nil, nil, errors.NotValidf("argument=%s value, expected 0 or 1", arg)
+		}
+		specs[i], values[i] = parts[0], byte(v)
+	}
+	return specs, values, nil
+}
+
+func wrapped(cfg config, args []string) error {
+	specs, values, err := parseAssignments(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch cfg.mode {
+	case "exit", "signal", "time", "toggle":
+	default:
+		return errors.NotValidf("mode=%s", cfg.mode)
+	}
+
+	chip, offsets, err := cliutil.OpenLines(cfg.chipID, "gpio-set", specs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer chip.Close()
+	// default values make request itself glitch-free, Flush is for consistency
+	lines, err := chip.OpenLinesWith(gpio.GPIOHANDLE_REQUEST_OUTPUT|cfg.reqFlag, "",
+		gpio.LineOptions{DefaultValues: values}, offsets...)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer lines.Close()
+	lines.SetBulk(values...)
+	if err = lines.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	switch cfg.mode {
+	case "signal":
+		<-stop
+	case "time":
+		select {
+		case <-stop:
+		case <-time.After(cfg.hold):
+		}
+	case "toggle":
+		tick := time.NewTicker(cfg.period)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-tick.C:
+			}
+			for i := range values {
+				values[i] ^= 1
+			}
+			lines.SetBulk(values...)
+			if err = lines.Flush(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	cmdline := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var cfg config
+	cmdline.StringVar(&cfg.chipID, "chip", "", "label, name, device or sysfs path, default "+cliutil.DefaultChip+" or chip of named lines")
+	activeLow := cmdline.Bool("active-low", false, "invert values")
+	bias := cmdline.String("bias", "", "as-is|pull-up|pull-down|disabled")
+	drive := cmdline.String("drive", "push-pull", "push-pull|open-drain|open-source")
+	cmdline.StringVar(&cfg.mode, "mode", "exit", "exit|signal|time|toggle")
+	cmdline.DurationVar(&cfg.hold, "hold", time.Second, "hold duration for -mode=time")
+	cmdline.DurationVar(&cfg.period, "period", time.Second, "toggle period for -mode=toggle")
+	_ = cmdline.Parse(os.Args[1:])
+
+	var err error
+	if cfg.reqFlag, err = cliutil.ParseBias(*bias); err != nil {
+		log.Fatal(err)
+	}
+	if *activeLow {
+		cfg.reqFlag |= gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW
+	}
+	switch *drive {
+	case "push-pull":
+	case "open-drain":
+		cfg.reqFlag |= gpio.GPIOHANDLE_REQUEST_OPEN_DRAIN
+	case "open-source":
+		cfg.reqFlag |= gpio.GPIOHANDLE_REQUEST_OPEN_SOURCE
+	default:
+		log.Fatalf("invalid drive=%s", *drive)
+	}
+	// checked before chip is opened, time.NewTicker panics on period <= 0
+	if cfg.mode == "toggle" && cfg.period <= 0 {
+		log.Fatal(errors.NotValidf("period=%s for -mode=toggle", cfg.period))
+	}
+	if cfg.hold < 0 {
+		log.Fatal(errors.NotValidf("hold=%s", cfg.hold))
+	}
+	if err = wrapped(cfg, cmdline.Args()); err != nil {
+		log.Fatal(errors.ErrorStack(err))
+	}
+}
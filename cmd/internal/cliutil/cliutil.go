@@ -0,0 +1,88 @@
+// Command line helpers shared by gpio-* tools.
+package cliutil
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+// Chip used when lines are given by offset without -chip.
+const DefaultChip = "gpiochip0"
+
+// Opens chip and resolves line specs, each is either offset or line name.
+// Without chipID, names are searched across all chips, see gpio.FindLine,
+// and must all be on the same chip.
+func OpenLines(chipID, consumer string, specs []string) (gpio.Chiper, []uint32, error) {
+	if len(specs) == 0 {
+		return nil, nil, errors.NotValidf("empty line list")
+	}
+	if chipID == "" {
+		var err error
+		if chipID, err = findChip(specs); err != nil {
+			return nil, nil, err
+		}
+	}
+	chip, err := gpio.OpenChip(chipID, consumer)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "chip=%s", chipID)
+	}
+	offsets := make([]uint32, len(specs))
+	for i, spec := range specs {
+		if n, err := strconv.ParseUint(spec, 10, 32); err == nil {
+			offsets[i] = uint32(n)
+			continue
+		}
+		found, err := chip.FindLines(spec)
+		if err != nil {
+			chip.Close()
+			return nil, nil, err
+		}
+		offsets[i] = found[0]
+	}
+	return chip, offsets, nil
+}
+
+func findChip(specs []string) (string, error) {
+	path := ""
+	for _, spec := range specs {
+		if _, err := strconv.ParseUint(spec, 10, 32); err == nil {
+			continue
+		}
+		loc, err := gpio.FindLine(spec)
+		if err != nil {
+			return "", err
+		}
+		if path != "" && loc.Chip.Path != path {
+			return "", errors.NotValidf("lines on different chips %s and %s", path, loc.Chip.Path)
+		}
+		path = loc.Chip.Path
+	}
+	if path == "" {
+		return DefaultChip, nil
+	}
+	return path, nil
+}
+
+// Parses -bias flag value.
+func ParseBias(s string) (gpio.RequestFlag, error) {
+	switch s {
+	case "", "as-is":
+		return 0, nil
+	case "pull-up":
+		return gpio.GPIOHANDLE_REQUEST_BIAS_PULL_UP, nil
+	case "pull-down":
+		return gpio.GPIOHANDLE_REQUEST_BIAS_PULL_DOWN, nil
+	case "disable", "disabled":
+		return gpio.GPIOHANDLE_REQUEST_BIAS_DISABLE, nil
+	}
+	return 0, errors.NotValidf("bias=%s, expected as-is|pull-up|pull-down|disabled", s)
+}
+
+// Repeatable flag, collects every value in order.
+type StringList []string
+
+func (l *StringList) String() string     { return strings.Join(*l, ",") }
+func (l *StringList) Set(s string) error { *l = append(*l, s); return nil }
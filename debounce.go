@@ -0,0 +1,74 @@
+package gpio
+
+import (
+	"math"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+func checkDebounce(d time.Duration) error {
+	if d < 0 || (d > 0 && d < time.Microsecond) || d/time.Microsecond > math.MaxUint32 {
+		return errors.NotValidf("Debounce=%s", d)
+	}
+	return nil
+}
+
+// Software fallback for kernel debounce, same semantics:
+// edge is reported only after line was stable at new value for `period`;
+// bounces that return to previous stable value are not reported at all;
+// event timestamp is CLOCK_MONOTONIC at the moment line is considered stable.
+// Kernel request always has both edges enabled, requested ones are filtered here.
+type softDebounce struct {
+	period  time.Duration
+	stable  byte // last reported value
+	pending bool // edge seen, waiting for line to settle
+}
+
+func (self *lineEvent) waitDebounced(deadline time.Time) (Event, error) {
+	sd := self.soft
+	for {
+		if !sd.pending {
+			if _, err := self.waitRaw(deadline); err != nil {
+				return Event{}, err
+			}
+			sd.pending = true
+		}
+
+		// drain edges until line is quiet for period
+		for sd.pending {
+			settle := time.Now().Add(sd.period)
+			capped := !deadline.IsZero() && deadline.Before(settle)
+			if capped {
+				settle = deadline
+			}
+			_, err := self.waitRaw(settle)
+			if err == ErrTimeout {
+				if capped {
+					// keep pending, next Wait continues settling
+					return Event{}, err
+				}
+				sd.pending = false
+			} else if err != nil {
+				return Event{}, err
+			}
+		}
+
+		value, err := self.Read()
+		if err != nil {
+			return Event{}, err
+		}
+		if value == sd.stable {
+			continue
+		}
+		sd.stable = value
+		e := Event{EventData: EventData{Timestamp: MonotonicNow(), ID: GPIOEVENT_EVENT_FALLING_EDGE}}
+		if value != 0 {
+			e.ID = GPIOEVENT_EVENT_RISING_EDGE
+		}
+		// event ID values match request flag bits
+		if self.events&EventFlag(e.ID) != 0 {
+			return e, nil
+		}
+	}
+}
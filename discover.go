@@ -0,0 +1,179 @@
+package gpio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// GPIO chip found on system, see ListChips.
+type ChipEntry struct {
+	// device node to pass to Open, like "/dev/gpiochip0"
+	Path string
+
+	// resolved sysfs device directory, like
+	// "/sys/devices/platform/soc/3f200000.gpio/gpiochip0",
+	// empty if sysfs is not mounted
+	SysfsPath string
+
+	Info ChipInfo
+
+	// set when chip info could not be read, like permission denied
+	// or driver not bound yet; Info is zero then, Path is still valid
+	Err error
+}
+
+func (e *ChipEntry) Name() string  { return cstr(e.Info.Name[:]) }
+func (e *ChipEntry) Label() string { return cstr(e.Info.Label[:]) }
+
+// Lists all GPIO chips on system, ordered by chip number.
+// Makes open+ioctl+close syscalls for each chip.
+// Chip which fails to open is listed with ChipEntry.Err, so one broken chip
+// doesn't hide the rest. Returned error is only for failure to list at all.
+func ListChips() ([]ChipEntry, error) { return ListChipsAt("/") }
+
+// Same as ListChips with `root` in place of "/".
+// Chips are found by /dev/gpiochipN and /sys/bus/gpio/devices/gpiochipN
+// relative to root.
+func ListChipsAt(root string) ([]ChipEntry, error) {
+	const tag = "ListChips"
+	devDir := filepath.Join(root, "dev")
+	sysDir := filepath.Join(root, "sys", "bus", "gpio", "devices")
+
+	names := make(map[string]struct{})
+	for _, dir := range []string{devDir, sysDir} {
+		matches, err := filepath.Glob(filepath.Join(dir, "gpiochip*"))
+		if err != nil {
+			return nil, errors.Annotate(err, tag)
+		}
+		for _, m := range matches {
+			if _, ok := chipNumber(filepath.Base(m)); ok {
+				names[filepath.Base(m)] = struct{}{}
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, _ := chipNumber(sorted[i])
+		b, _ := chipNumber(sorted[j])
+		return a < b
+	})
+
+	chips := make([]ChipEntry, 0, len(sorted))
+	for _, name := range sorted {
+		e := ChipEntry{Path: filepath.Join(devDir, name)}
+		if _, err := os.Stat(e.Path); os.IsNotExist(err) {
+			// sysfs only, without device node there is nothing to open
+			continue
+		}
+		if sp, err := filepath.EvalSymlinks(filepath.Join(sysDir, name)); err == nil {
+			e.SysfsPath = sp
+		}
+		if info, err := readChipInfo(e.Path); err != nil {
+			e.Err = errors.Annotatef(err, "%s path=%s", tag, e.Path)
+		} else {
+			e.Info = info
+		}
+		chips = append(chips, e)
+	}
+	return chips, nil
+}
+
+// "gpiochip12" -> 12
+func chipNumber(name string) (int, bool) {
+	if !strings.HasPrefix(name, "gpiochip") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(name, "gpiochip"))
+	return n, err == nil
+}
+
+// variable for tests with fake tree
+var readChipInfo = func(path string) (ChipInfo, error) {
+	var info ChipInfo
+	fd, err := syscall.Open(path, chipOpenFlags, 0)
+	if err != nil {
+		return info, err
+	}
+	err = RawGetChipInfo(fd, &info)
+	_ = syscall.Close(fd)
+	return info, err
+}
+
+// Returned when chip identifier matches more than one chip.
+type AmbiguousChipError struct {
+	ID    string
+	Found []ChipEntry
+}
+
+func (e *AmbiguousChipError) Error() string {
+	paths := make([]string, len(e.Found))
+	for i, c := range e.Found {
+		paths[i] = c.Path
+	}
+	return fmt.Sprintf("chip id=%s is ambiguous, matches %s", e.ID, strings.Join(paths, " "))
+}
+
+func IsAmbiguousChip(err error) bool {
+	_, ok := errors.Cause(err).(*AmbiguousChipError)
+	return ok
+}
+
+// Finds chip by label ("pinctrl-bcm2835"), kernel name ("gpiochip0"),
+// device node path or sysfs device path, either of parent device
+// ("/sys/devices/platform/soc/3f200000.gpio") or chip itself.
+// Symlinks in sysfs path are resolved, so "/sys/bus/platform/devices/..." works too.
+// Missing chip returns NotFound error (check with errors.IsNotFound),
+// more than one match returns *AmbiguousChipError.
+func FindChip(id string) (ChipEntry, error) { return FindChipAt("/", id) }
+
+// Same as FindChip with `root` in place of "/", see ListChipsAt.
+func FindChipAt(root, id string) (ChipEntry, error) {
+	chips, err := ListChipsAt(root)
+	if err != nil {
+		return ChipEntry{}, errors.Annotate(err, "FindChip")
+	}
+	resolved := id
+	if filepath.IsAbs(id) {
+		if p, err := filepath.EvalSymlinks(id); err == nil {
+			resolved = p
+		}
+	}
+	var found []ChipEntry
+	for _, c := range chips {
+		// unreadable chip has no label or name, but path still matches
+		// so that Open reports actual error
+		byInfo := c.Err == nil && (c.Label() == id || c.Name() == id)
+		if byInfo || c.Path == id ||
+			(c.SysfsPath != "" && (c.SysfsPath == resolved || filepath.Dir(c.SysfsPath) == resolved)) {
+			found = append(found, c)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return ChipEntry{}, errors.NotFoundf("chip id=%s", id)
+	case 1:
+		return found[0], nil
+	}
+	return ChipEntry{}, &AmbiguousChipError{ID: id, Found: found}
+}
+
+// Same as Open with chip identifier accepted by FindChip instead of path.
+// Stable across boards where chip numbering differs.
+func OpenChip(id, defaultConsumer string) (Chiper, error) {
+	c, err := FindChip(id)
+	if err != nil {
+		return nil, err
+	}
+	return Open(c.Path, defaultConsumer)
+}
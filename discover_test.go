@@ -0,0 +1,184 @@
+package gpio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates fake /dev and /sys tree.
+// Device node content is chip label, followed by line names, one per line.
+func fakeChipTree(t *testing.T, chips map[string][]string) string {
+	root, err := ioutil.TempDir("", "gpio-test-")
+	require.NoError(t, err)
+	for _, dir := range []string{"dev", "sys/bus/gpio/devices", "sys/devices/platform"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	for name, content := range chips {
+		label := content[0]
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, "dev", name), []byte(strings.Join(content, "\n")), 0644))
+		devDir := filepath.Join(root, "sys/devices/platform", label, name)
+		require.NoError(t, os.MkdirAll(devDir, 0755))
+		require.NoError(t, os.Symlink(devDir, filepath.Join(root, "sys/bus/gpio/devices", name)))
+	}
+	return root
+}
+
+// Returns func to restore original.
+func stubReadChipInfo() func() {
+	orig := readChipInfo
+	origNames := readLineNames
+	readChipInfo = func(path string) (ChipInfo, error) {
+		var info ChipInfo
+		b, err := ioutil.ReadFile(path)
+		content := strings.Split(string(b), "\n")
+		copy(info.Name[:], filepath.Base(path))
+		copy(info.Label[:], content[0])
+		info.Lines = uint32(len(content) - 1)
+		return info, err
+	}
+	readLineNames = func(e ChipEntry) ([]string, error) {
+		b, err := ioutil.ReadFile(e.Path)
+		return strings.Split(string(b), "\n")[1:], err
+	}
+	return func() { readChipInfo, readLineNames = orig, origNames }
+}
+
+var testChips = map[string][]string{
+	"gpiochip0":  {"pinctrl-bcm2835", "ID_SDA", "ID_SCL", "GPIO17", "RELAY_3"},
+	"gpiochip10": {"1c20800.pinctrl", "PA0", "", "DUP"},
+	"gpiochip2":  {"raspberrypi-exp-gpio", "BT_ON", "DUP"},
+}
+
+func TestListChipsAt(t *testing.T) {
+	defer stubReadChipInfo()()
+	root := fakeChipTree(t, testChips)
+	defer os.RemoveAll(root)
+	// sysfs without device node is skipped, random names ignored
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sys/bus/gpio/devices/gpiochip7"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "dev/gpiochipX"), nil, 0644))
+
+	chips, err := ListChipsAt(root)
+	require.NoError(t, err)
+	require.Len(t, chips, 3)
+	assert.Equal(t, filepath.Join(root, "dev/gpiochip0"), chips[0].Path)
+	assert.Equal(t, "gpiochip2", chips[1].Name())
+	assert.Equal(t, "1c20800.pinctrl", chips[2].Label())
+	assert.Equal(t, uint32(3), chips[2].Info.Lines)
+	sysPath, _ := filepath.EvalSymlinks(filepath.Join(root, "sys/devices/platform/pinctrl-bcm2835/gpiochip0"))
+	assert.Equal(t, sysPath, chips[0].SysfsPath)
+}
+
+// testdata/unreadable/dev/gpiochip1 is directory, stands for chip which
+// can't be opened, like permission denied or half-bound driver.
+func TestListChipsUnreadable(t *testing.T) {
+	defer stubReadChipInfo()()
+	root := filepath.Join("testdata", "unreadable")
+
+	chips, err := ListChipsAt(root)
+	require.NoError(t, err)
+	require.Len(t, chips, 3)
+	assert.NoError(t, chips[0].Err)
+	assert.Equal(t, "pinctrl-test", chips[0].Label())
+	assert.Error(t, chips[1].Err)
+	assert.Equal(t, filepath.Join(root, "dev/gpiochip1"), chips[1].Path)
+	assert.Equal(t, "", chips[1].Name())
+	assert.Equal(t, "gpio-expander", chips[2].Label())
+
+	c, err := FindChipAt(root, "gpio-expander")
+	require.NoError(t, err)
+	assert.Equal(t, "gpiochip2", c.Name())
+	c, err = FindChipAt(root, filepath.Join(root, "dev/gpiochip1"))
+	require.NoError(t, err)
+	assert.Error(t, c.Err)
+	_, err = FindChipAt(root, "")
+	assert.True(t, errors.IsNotFound(err), "unreadable chip must not match empty label, err=%v", err)
+
+	loc, err := FindLineAt(root, "RELAY")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), loc.Offset)
+	_, err = FindLineAt(root, "MISSING")
+	assert.True(t, errors.IsNotFound(err), "err=%v", err)
+	assert.Contains(t, err.Error(), "gpiochip1")
+}
+
+func TestFindLineAt(t *testing.T) {
+	defer stubReadChipInfo()()
+	root := fakeChipTree(t, testChips)
+	defer os.RemoveAll(root)
+
+	loc, err := FindLineAt(root, "RELAY_3")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "dev/gpiochip0"), loc.Chip.Path)
+	assert.Equal(t, uint32(3), loc.Offset)
+
+	_, err = FindLineAt(root, "GPIO99")
+	assert.True(t, errors.IsNotFound(err), "err=%v", err)
+	_, err = FindLineAt(root, "")
+	assert.True(t, errors.IsNotFound(err), "unnamed lines must not match, err=%v", err)
+
+	_, err = FindLineAt(root, "DUP")
+	require.True(t, IsDuplicateLine(err), "err=%v", err)
+	assert.Len(t, err.(*DuplicateLineError).Found, 2)
+}
+
+func TestFindLinesRepeated(t *testing.T) {
+	// chip without lines makes no syscalls
+	c := &chip{}
+	_, err := c.FindLines("LED", "BUTTON", "LED")
+	assert.True(t, errors.IsNotValid(err), "err=%v", err)
+	_, err = c.OpenLinesByName(GPIOHANDLE_REQUEST_OUTPUT, "", "LED", "LED")
+	assert.True(t, errors.IsNotValid(err), "err=%v", err)
+}
+
+func TestMatchLineNames(t *testing.T) {
+	entry := ChipEntry{Path: "/dev/gpiochip0"}
+	copy(entry.Info.Name[:], "gpiochip0")
+	lineNames := []string{"LED", "", "BUTTON", "LED"}
+	offsets, err := MatchLineNames(entry, lineNames, "BUTTON")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{2}, offsets)
+	_, err = MatchLineNames(entry, lineNames, "")
+	assert.True(t, errors.IsNotFound(err), "unnamed lines never match err=%v", err)
+	_, err = MatchLineNames(entry, lineNames, "LED")
+	require.True(t, IsDuplicateLine(err), "err=%v", err)
+	assert.Equal(t, "line name=LED is not unique, found at /dev/gpiochip0:0 /dev/gpiochip0:3", err.Error())
+	_, err = MatchLineNames(entry, lineNames, "BUTTON", "BUTTON")
+	assert.True(t, errors.IsNotValid(err), "err=%v", err)
+}
+
+func TestFindChipAt(t *testing.T) {
+	defer stubReadChipInfo()()
+	root := fakeChipTree(t, testChips)
+	defer os.RemoveAll(root)
+	// second chip of same device
+	devDir := filepath.Join(root, "sys/devices/platform/1c20800.pinctrl/gpiochip11")
+	require.NoError(t, os.MkdirAll(devDir, 0755))
+	require.NoError(t, os.Symlink(devDir, filepath.Join(root, "sys/bus/gpio/devices/gpiochip11")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "dev/gpiochip11"), []byte("1c20800.r_pinctrl\nPL0"), 0644))
+
+	for _, id := range []string{
+		"pinctrl-bcm2835",
+		"gpiochip0",
+		filepath.Join(root, "dev/gpiochip0"),
+		filepath.Join(root, "sys/devices/platform/pinctrl-bcm2835"),
+		filepath.Join(root, "sys/bus/gpio/devices/gpiochip0"),
+	} {
+		c, err := FindChipAt(root, id)
+		if assert.NoError(t, err, "id=%s", id) {
+			assert.Equal(t, "gpiochip0", c.Name(), "id=%s", id)
+		}
+	}
+
+	_, err := FindChipAt(root, "nonexistent")
+	assert.True(t, errors.IsNotFound(err), "err=%v", err)
+	_, err = FindChipAt(root, filepath.Join(root, "sys/devices/platform/1c20800.pinctrl"))
+	require.True(t, IsAmbiguousChip(err), "err=%v", err)
+	assert.Len(t, err.(*AmbiguousChipError).Found, 2)
+}
@@ -12,21 +12,46 @@ import (
 )
 
 func (c *chip) GetLineEvent(line uint32, flag RequestFlag, events EventFlag, consumerLabel string) (Eventer, error) {
+	return c.GetLineEventWith(line, flag, events, consumerLabel, EventOptions{})
+}
+
+// Same as GetLineEvent with extra options.
+// `opt.Debounce` uses kernel debounce with v2 ABI. With v1 ABI it is
+// emulated in Eventer.Wait, see softDebounce for details.
+func (c *chip) GetLineEventWith(line uint32, flag RequestFlag, events EventFlag, consumerLabel string, opt EventOptions) (Eventer, error) {
+	if err := opt.check(flag); err != nil {
+		return nil, err
+	}
 	if !c.fa.incref() {
 		return nil, ErrClosed
 	}
+	if c.v2 {
+		return c.getLineEventV2([]uint32{line}, flag, events, consumerLabel, opt)
+	}
+	if opt.Clock != EventClockMonotonic {
+		c.fa.decref()
+		return nil, errors.NotSupportedf("Clock=%s on v1 ABI", opt.Clock)
+	}
+	if opt.BufferSize > eventBufferSizeV1 {
+		c.fa.decref()
+		return nil, errors.NotSupportedf("BufferSize=%d on v1 ABI, fixed %d", opt.BufferSize, eventBufferSizeV1)
+	}
 
 	req := EventRequest{
 		LineOffset:   line,
 		RequestFlags: GPIOHANDLE_REQUEST_INPUT | flag,
 		EventFlags:   events,
 	}
-	copy(req.ConsumerLabel[:], []byte(consumerLabel))
+	if opt.Debounce != 0 {
+		// software debounce must see both edges to know when line settles
+		req.EventFlags = GPIOEVENT_REQUEST_BOTH_EDGES
+	}
+	copy(req.ConsumerLabel[:], []byte(c.consumer(consumerLabel)))
 
 	err := RawGetLineEvent(c.fa.fd, &req)
 	if err != nil {
 		c.fa.decref()
-		err = errors.Annotate(err, "GPIO_GET_LINEEVENT_IOCTL")
+		err = annotateRequest(err, "GPIO_GET_LINEEVENT_IOCTL", req.RequestFlags, []uint32{line})
 		return nil, err
 	}
 
@@ -40,13 +65,78 @@ func (c *chip) GetLineEvent(line uint32, flag RequestFlag, events EventFlag, con
 		chip:    c,
 		f:       os.NewFile(uintptr(req.Fd), fmt.Sprintf("gpio:event:%d", line)),
 		reqFlag: req.RequestFlags,
-		events:  req.EventFlags,
+		events:  events,
 		line:    line,
+		bufSize: eventBufferSizeV1,
+	}
+	if opt.Debounce != 0 {
+		le.soft = &softDebounce{period: opt.Debounce}
+		if le.soft.stable, err = le.Read(); err != nil {
+			_ = le.Close()
+			return nil, err
+		}
 	}
 	// runtime.SetFinalizer(le, func(le *lineEvent) { le.Close() })
 	return le, nil
 }
 
+// Edge events on many lines with single fd, v2 ABI only.
+// Event.LineOffset tells which line fired.
+// Eventer.Read() returns value of first line.
+// With v1 ABI single line falls back to GetLineEventWith, more fail with NotSupported.
+func (c *chip) GetLinesEvent(lines []uint32, flag RequestFlag, events EventFlag, consumerLabel string, opt EventOptions) (Eventer, error) {
+	if len(lines) == 0 || len(lines) > GPIO_V2_LINES_MAX {
+		return nil, errors.NotValidf("lines count=%d", len(lines))
+	}
+	if !c.v2 {
+		if len(lines) == 1 {
+			return c.GetLineEventWith(lines[0], flag, events, consumerLabel, opt)
+		}
+		return nil, errors.NotSupportedf("GetLinesEvent count=%d on v1 ABI", len(lines))
+	}
+	if err := opt.check(flag); err != nil {
+		return nil, err
+	}
+	if !c.fa.incref() {
+		return nil, ErrClosed
+	}
+	return c.getLineEventV2(lines, flag, events, consumerLabel, opt)
+}
+
+func (opt *EventOptions) check(flag RequestFlag) error {
+	if err := (GPIOHANDLE_REQUEST_INPUT | flag).Check(); err != nil {
+		return err
+	}
+	if err := checkDebounce(opt.Debounce); err != nil {
+		return err
+	}
+	if opt.Clock > EventClockHTE {
+		return errors.NotValidf("Clock=%d", opt.Clock)
+	}
+	return nil
+}
+
+// kfifo size in v1 lineevent_state
+const eventBufferSizeV1 = 16
+
+// Mirrors kernel linereq_create() logic, which doesn't report size back.
+// Eventer.BufferSize of v2 request with EventOptions.BufferSize=requested.
+func EventBufferSizeV2(requested, lines uint32) uint32 {
+	const limit = GPIO_V2_LINES_MAX * 16
+	size := requested
+	if size > limit {
+		size = limit
+	} else if size == 0 {
+		size = lines * 16
+	}
+	// kfifo_alloc rounds up to power of 2
+	p := uint32(1)
+	for p < size {
+		p <<= 1
+	}
+	return p
+}
+
 type lineEvent struct {
 	chip    *chip
 	f       *os.File
@@ -54,6 +144,12 @@ type lineEvent struct {
 	events  EventFlag
 	line    uint32
 	closed  uint32
+	v2      bool
+	soft    *softDebounce
+	clock   EventClock
+	seqno   uint32 // last seen
+	dropped uint64 // atomic
+	bufSize uint32
 }
 
 func (self *lineEvent) Close() error {
@@ -68,6 +164,14 @@ func (self *lineEvent) Close() error {
 }
 
 func (self *lineEvent) Read() (byte, error) {
+	if self.v2 {
+		lv := LineValues{Mask: 1}
+		err := RawGetLineValuesV2(int(self.f.Fd()), &lv)
+		if err != nil {
+			err = errors.Annotate(err, "event.Read")
+		}
+		return byte(lv.Bits & 1), err
+	}
 	var data HandleData
 	err := RawGetLineValues(int(self.f.Fd()), &data)
 	if err != nil {
@@ -76,19 +180,27 @@ func (self *lineEvent) Read() (byte, error) {
 	return data.Values[0], err
 }
 
-func (self *lineEvent) Wait(timeout time.Duration) (EventData, error) {
+func (self *lineEvent) Wait(timeout time.Duration) (Event, error) {
 	const tag = "event.Wait"
 	var deadline time.Time
-	var e EventData
+	var e Event
 	var err error
 	if timeout != 0 {
 		deadline = time.Now().Add(timeout)
 	}
-	if err = self.f.SetDeadline(deadline); err != nil {
-		err = errors.Annotate(err, tag)
-		return e, err
+	if self.soft != nil {
+		e, err = self.waitDebounced(deadline)
+	} else {
+		e, err = self.waitRaw(deadline)
+	}
+	if err == nil {
+		e.Clock = self.clock
+		if !self.v2 {
+			self.seqno++
+			e.Seqno, e.LineSeqno = self.seqno, self.seqno
+			e.LineOffset = self.line
+		}
 	}
-	e, err = self.readEvent()
 	// specifically don't annotate timeout, to ease external code checks
 	if err == ErrTimeout {
 		return e, err
@@ -99,12 +211,30 @@ func (self *lineEvent) Wait(timeout time.Duration) (EventData, error) {
 	return e, err
 }
 
-func (self *lineEvent) readEvent() (EventData, error) {
+// Returns number of events lost due to kernel buffer overflow,
+// detected by gaps in Event.Seqno. v1 ABI has no sequence numbers,
+// so it always returns 0.
+func (self *lineEvent) Dropped() uint64 { return atomic.LoadUint64(&self.dropped) }
+
+// Returns kernel event buffer size in effect, in events.
+func (self *lineEvent) BufferSize() uint32 { return self.bufSize }
+
+func (self *lineEvent) waitRaw(deadline time.Time) (Event, error) {
+	if err := self.f.SetDeadline(deadline); err != nil {
+		return Event{}, err
+	}
+	return self.readEvent()
+}
+
+func (self *lineEvent) readEvent() (Event, error) {
+	if self.v2 {
+		return self.readEventV2()
+	}
 	// dance around File.Read []byte
 	const esz = int(unsafe.Sizeof(EventData{}))
 	type eventBuf [esz]byte
 	var buf eventBuf
-	var e EventData
+	var e Event
 	var n int
 	var err error
 	n, err = self.f.Read(buf[:])
@@ -119,7 +249,7 @@ func (self *lineEvent) readEvent() (EventData, error) {
 		err = errors.Errorf("readEvent fail n=%d expected=%d", n, esz)
 		return e, err
 	}
-	eb := (*eventBuf)(unsafe.Pointer(&e))
+	eb := (*eventBuf)(unsafe.Pointer(&e.EventData))
 	copy((*eb)[:], buf[:])
 	return e, nil
 }
@@ -0,0 +1,413 @@
+// Prometheus/OpenMetrics exporter of line values and edge counters.
+// Sampled lines are read with Lineser.Read every Config.Interval,
+// counted lines are requested as Eventer, their value follows edges
+// and is read again when kernel dropped events.
+//
+// Metrics, all with labels chip, line, name:
+//
+//	gpio_line_value                   gauge, 0 or 1
+//	gpio_line_last_change_seconds     gauge, unix time of last value change seen by exporter
+//	gpio_line_edges_total             counter, label edge="rising|falling", counted lines only
+//	gpio_line_errors_total            counter, failed reads and waits
+//	gpio_line_info                    info, consumer, direction, active_low, bias from LineInfo
+//	gpio_chip_info                    info, chip, label, lines from ChipInfo
+//
+// Alert on stuck door sensor: time() - gpio_line_last_change_seconds > 86400
+// Alert on stopped fan tach: rate(gpio_line_edges_total[1m]) == 0
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Line to export.
+type Line struct {
+	Line uint32
+
+	// sampled lines with equal Flag share one request, e.g. bias or active-low
+	Flag gpio.RequestFlag
+
+	// request as Eventer and count edges instead of sampling
+	Count bool
+
+	// counted lines only, see gpio.EventOptions.Debounce
+	Debounce time.Duration
+}
+
+type Config struct {
+	Lines []Line
+
+	// sampling period, default 1s
+	Interval time.Duration
+
+	// shown in LineInfo of exported lines, chip default when empty
+	Consumer string
+}
+
+type Exporter struct {
+	chip     gpio.Chiper
+	chipInfo gpio.ChipInfo
+	interval time.Duration
+	lines    []*line
+	// sampled lines grouped by request flags, one Lineser per group
+	groups []*group
+
+	closed uint32
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type group struct {
+	lines  gpio.Lineser
+	member []*line // in LineOffsets order
+}
+
+type line struct {
+	offset uint32
+	name   string
+	event  gpio.Eventer
+
+	mu         sync.Mutex
+	known      bool // value was read at least once
+	value      byte
+	lastChange time.Time
+	rising     uint64
+	falling    uint64
+	errors     uint64
+	dropped    uint64 // last seen Eventer.Dropped
+}
+
+// Requests lines and starts sampling and counting until Close.
+func New(chip gpio.Chiper, cfg Config) (*Exporter, error) {
+	const tag = "exporter.New"
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	e := &Exporter{
+		chip:     chip,
+		chipInfo: chip.Info(),
+		interval: cfg.Interval,
+		done:     make(chan struct{}),
+	}
+	seen := make(map[uint32]bool, len(cfg.Lines))
+	byFlag := make(map[gpio.RequestFlag][]*line)
+	var flags []gpio.RequestFlag
+	for _, cl := range cfg.Lines {
+		if seen[cl.Line] {
+			e.Close()
+			return nil, errors.NotValidf("%s duplicate line=%d", tag, cl.Line)
+		}
+		seen[cl.Line] = true
+		li, err := chip.LineInfo(cl.Line)
+		if err != nil {
+			e.Close()
+			return nil, errors.Annotatef(err, "%s line=%d", tag, cl.Line)
+		}
+		l := &line{offset: cl.Line, name: li.NameString()}
+		e.lines = append(e.lines, l)
+		if !cl.Count {
+			if _, ok := byFlag[cl.Flag]; !ok {
+				flags = append(flags, cl.Flag)
+			}
+			byFlag[cl.Flag] = append(byFlag[cl.Flag], l)
+			continue
+		}
+		if l.event, err = chip.GetLineEventWith(cl.Line, cl.Flag, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, cfg.Consumer,
+			gpio.EventOptions{Debounce: cl.Debounce}); err != nil {
+			e.Close()
+			return nil, errors.Annotatef(err, "%s line=%d", tag, cl.Line)
+		}
+	}
+	for _, flag := range flags {
+		g := &group{member: byFlag[flag]}
+		offsets := make([]uint32, len(g.member))
+		for i, l := range g.member {
+			offsets[i] = l.offset
+		}
+		var err error
+		if g.lines, err = chip.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT|flag, cfg.Consumer, offsets...); err != nil {
+			e.Close()
+			return nil, errors.Annotatef(err, "%s lines=%v", tag, offsets)
+		}
+		e.groups = append(e.groups, g)
+	}
+
+	// first sample before any scrape
+	e.sample()
+	e.wg.Add(1)
+	go e.sampleLoop()
+	for _, l := range e.lines {
+		if l.event != nil {
+			e.wg.Add(1)
+			go e.count(l)
+		}
+	}
+	return e, nil
+}
+
+// Stops sampling and releases all lines.
+func (e *Exporter) Close() error {
+	if atomic.AddUint32(&e.closed, 1) != 1 {
+		return gpio.ErrClosed
+	}
+	close(e.done)
+	var firstErr error
+	// ends blocked Wait in count
+	for _, l := range e.lines {
+		if l.event != nil {
+			if err := l.event.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	e.wg.Wait()
+	for _, g := range e.groups {
+		if err := g.lines.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (e *Exporter) sampleLoop() {
+	defer e.wg.Done()
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-t.C:
+			e.sample()
+		}
+	}
+}
+
+func (e *Exporter) sample() {
+	now := time.Now()
+	for _, g := range e.groups {
+		data, err := g.lines.Read()
+		for i, l := range g.member {
+			if err != nil {
+				l.mu.Lock()
+				l.errors++
+				l.mu.Unlock()
+				continue
+			}
+			l.update(data.Values[i], now)
+		}
+	}
+	for _, l := range e.lines {
+		if l.event == nil {
+			continue
+		}
+		l.mu.Lock()
+		known := l.known
+		l.mu.Unlock()
+		if known {
+			continue
+		}
+		// counted line value is known from edges, initial read only
+		if v, err := l.event.Read(); err == nil {
+			l.update(v, now)
+		} else {
+			l.mu.Lock()
+			l.errors++
+			l.mu.Unlock()
+		}
+	}
+}
+
+// Delay after failed Wait, doubles while errors repeat.
+const (
+	errorBackoffMin = 10 * time.Millisecond
+	errorBackoffMax = 10 * time.Second
+)
+
+func (e *Exporter) count(l *line) {
+	defer e.wg.Done()
+	var backoff time.Duration
+	for {
+		ev, err := l.event.Wait(0)
+		if gpio.IsClosed(err) {
+			return
+		}
+		if err != nil {
+			l.mu.Lock()
+			l.errors++
+			l.mu.Unlock()
+			// persistent error like EIO must not spin
+			if backoff *= 2; backoff < errorBackoffMin {
+				backoff = errorBackoffMin
+			} else if backoff > errorBackoffMax {
+				backoff = errorBackoffMax
+			}
+			select {
+			case <-e.done:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+		var v byte
+		l.mu.Lock()
+		if ev.ID == gpio.GPIOEVENT_EVENT_RISING_EDGE {
+			l.rising++
+			v = 1
+		} else {
+			l.falling++
+		}
+		l.mu.Unlock()
+		l.update(v, ev.Time())
+
+		// value of last edge is stale after kernel dropped events
+		if dropped := l.event.Dropped(); dropped != l.dropped {
+			l.dropped = dropped
+			if v, err = l.event.Read(); err == nil {
+				l.update(v, time.Now())
+			} else {
+				l.mu.Lock()
+				l.errors++
+				l.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (l *line) update(v byte, t time.Time) {
+	l.mu.Lock()
+	if !l.known || v != l.value {
+		l.lastChange = t
+	}
+	l.known, l.value = true, v
+	l.mu.Unlock()
+}
+
+// Serves metrics in OpenMetrics text format on any path.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	bw := bufio.NewWriter(w)
+	e.writeMetrics(bw)
+	_ = bw.Flush()
+}
+
+// Copy of line state taken under lock.
+type lineSnapshot struct {
+	offset     uint32
+	name       string
+	counted    bool
+	known      bool
+	value      byte
+	lastChange time.Time
+	rising     uint64
+	falling    uint64
+	errors     uint64
+	state      gpio.LineState
+}
+
+func (e *Exporter) writeMetrics(w io.Writer) {
+	entry := gpio.ChipEntry{Info: e.chipInfo}
+	chipName := entry.Name()
+	snaps := make([]lineSnapshot, len(e.lines))
+	for i, l := range e.lines {
+		l.mu.Lock()
+		snaps[i] = lineSnapshot{
+			offset:     l.offset,
+			name:       l.name,
+			counted:    l.event != nil,
+			known:      l.known,
+			value:      l.value,
+			lastChange: l.lastChange,
+			rising:     l.rising,
+			falling:    l.falling,
+			errors:     l.errors,
+		}
+		l.mu.Unlock()
+		// info is not cached, consumer and config change outside of exporter
+		if li, err := e.chip.LineInfo(l.offset); err == nil {
+			snaps[i].state = li.State()
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].offset < snaps[j].offset })
+	labels := func(s *lineSnapshot, extra ...string) string {
+		return formatLabels(append([]string{"chip", chipName, "line", strconv.FormatUint(uint64(s.offset), 10), "name", s.name}, extra...)...)
+	}
+
+	writeHeader(w, "gpio_chip", "info", "GPIO chip.")
+	fmt.Fprintf(w, "gpio_chip_info%s 1\n", formatLabels("chip", chipName, "label", entry.Label(),
+		"lines", strconv.FormatUint(uint64(e.chipInfo.Lines), 10)))
+
+	writeHeader(w, "gpio_line", "info", "Line configuration from LineInfo.")
+	for i := range snaps {
+		s := &snaps[i]
+		fmt.Fprintf(w, "gpio_line_info%s 1\n", labels(s, "consumer", s.state.Consumer, "direction", s.state.Direction,
+			"active_low", strconv.FormatBool(s.state.ActiveLow), "bias", s.state.Bias))
+	}
+
+	writeHeader(w, "gpio_line_value", "gauge", "Line value, 0 or 1.")
+	for i := range snaps {
+		if s := &snaps[i]; s.known {
+			fmt.Fprintf(w, "gpio_line_value%s %d\n", labels(s), s.value)
+		}
+	}
+
+	writeHeader(w, "gpio_line_last_change_seconds", "gauge", "Unix time of last value change seen by exporter.")
+	for i := range snaps {
+		if s := &snaps[i]; s.known {
+			fmt.Fprintf(w, "gpio_line_last_change_seconds%s %.3f\n", labels(s), float64(s.lastChange.UnixNano())/1e9)
+		}
+	}
+
+	writeHeader(w, "gpio_line_edges", "counter", "Edges since exporter start.")
+	for i := range snaps {
+		if s := &snaps[i]; s.counted {
+			fmt.Fprintf(w, "gpio_line_edges_total%s %d\n", labels(s, "edge", "rising"), s.rising)
+			fmt.Fprintf(w, "gpio_line_edges_total%s %d\n", labels(s, "edge", "falling"), s.falling)
+		}
+	}
+
+	writeHeader(w, "gpio_line_errors", "counter", "Failed line reads and event waits.")
+	for i := range snaps {
+		s := &snaps[i]
+		fmt.Fprintf(w, "gpio_line_errors_total%s %d\n", labels(s), s.errors)
+	}
+	io.WriteString(w, "# EOF\n")
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", name, typ, name, help)
+}
+
+// {k1="v1",k2="v2"} from pairs
+func formatLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,131 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/temoto/gpio-cdev-go"
+	gpio_mock "github.com/temoto/gpio-cdev-go/mock"
+)
+
+func TestExporter(t *testing.T) {
+	var info gpio.ChipInfo
+	copy(info.Name[:], "gpiochip0")
+	copy(info.Label[:], "pinctrl-test")
+	info.Lines = 8
+	chip := &gpio_mock.MockChip{}
+	chip.On("Info").Return(info)
+	door := gpio.LineInfo{LineOffset: 4, Flags: gpio.GPIOLINE_FLAG_KERNEL | gpio.GPIOLINE_FLAG_BIAS_PULL_UP}
+	copy(door.Name[:], "DOOR")
+	copy(door.Consumer[:], "test")
+	chip.On("LineInfo", uint32(4)).Return(door, nil)
+	fan := gpio.LineInfo{LineOffset: 7, Flags: gpio.GPIOLINE_FLAG_KERNEL}
+	copy(fan.Name[:], `FAN "1"`)
+	chip.On("LineInfo", uint32(7)).Return(fan, nil)
+
+	lines := &gpio_mock.MockLines{}
+	lines.On("Read").Return(gpio.HandleData{Values: [gpio.GPIOHANDLES_MAX]byte{1}}, nil)
+	lines.On("Close").Return(nil)
+	chip.On("OpenLines", gpio.GPIOHANDLE_REQUEST_INPUT|gpio.GPIOHANDLE_REQUEST_BIAS_PULL_UP, "", uint32(4)).Return(lines, nil)
+	ev := &gpio_mock.MockEvent{}
+	ev.On("Read").Return(byte(0), nil)
+	ev.On("Dropped").Return(uint64(0))
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{EventData: gpio.EventData{ID: gpio.GPIOEVENT_EVENT_RISING_EDGE}}, nil).Twice()
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{EventData: gpio.EventData{ID: gpio.GPIOEVENT_EVENT_FALLING_EDGE}}, nil).Once()
+	// real Eventer ends blocked Wait on Close
+	closed := make(chan struct{})
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{}, gpio.ErrClosed).Run(func(mock.Arguments) { <-closed })
+	ev.On("Close").Return(nil).Run(func(mock.Arguments) { close(closed) })
+	chip.On("GetLineEventWith", uint32(7), gpio.RequestFlag(0), gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "", gpio.EventOptions{}).Return(ev, nil)
+
+	e, err := New(chip, Config{Lines: []Line{
+		{Line: 7, Count: true},
+		{Line: 4, Flag: gpio.GPIOHANDLE_REQUEST_BIAS_PULL_UP},
+	}})
+	require.NoError(t, err)
+	defer e.Close()
+
+	var body string
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+		b, _ := ioutil.ReadAll(w.Body)
+		body = string(b)
+		if strings.Contains(body, `edge="falling"} 1`) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, expect := range []string{
+		"# TYPE gpio_chip info\n",
+		`gpio_chip_info{chip="gpiochip0",label="pinctrl-test",lines="8"} 1` + "\n",
+		`gpio_line_info{chip="gpiochip0",line="4",name="DOOR",consumer="test",direction="input",active_low="false",bias="pull-up"} 1` + "\n",
+		"# TYPE gpio_line_value gauge\n",
+		`gpio_line_value{chip="gpiochip0",line="4",name="DOOR"} 1` + "\n",
+		`gpio_line_value{chip="gpiochip0",line="7",name="FAN \"1\""} 0` + "\n",
+		"# TYPE gpio_line_edges counter\n",
+		`gpio_line_edges_total{chip="gpiochip0",line="7",name="FAN \"1\"",edge="rising"} 2` + "\n",
+		`gpio_line_edges_total{chip="gpiochip0",line="7",name="FAN \"1\"",edge="falling"} 1` + "\n",
+		`gpio_line_errors_total{chip="gpiochip0",line="4",name="DOOR"} 0` + "\n",
+		`gpio_line_last_change_seconds{chip="gpiochip0",line="4",name="DOOR"} `,
+	} {
+		assert.Contains(t, body, expect)
+	}
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+	// sampled line has no edge counter
+	assert.NotContains(t, body, `gpio_line_edges_total{chip="gpiochip0",line="4"`)
+	assert.True(t, strings.Index(body, `line="4"`) < strings.Index(body, `line="7"`), "sorted by offset")
+}
+
+func TestCountErrors(t *testing.T) {
+	chip := &gpio_mock.MockChip{}
+	chip.On("Info").Return(gpio.ChipInfo{Lines: 8})
+	chip.On("LineInfo", uint32(7)).Return(gpio.LineInfo{LineOffset: 7}, nil)
+	ev := &gpio_mock.MockEvent{}
+	ev.On("Read").Return(byte(0), nil)
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{EventData: gpio.EventData{ID: gpio.GPIOEVENT_EVENT_RISING_EDGE}}, nil).Once()
+	ev.On("Dropped").Return(uint64(1))
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{}, errors.New("EIO"))
+	ev.On("Close").Return(nil)
+	chip.On("GetLineEventWith", uint32(7), gpio.RequestFlag(0), gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "", gpio.EventOptions{}).Return(ev, nil)
+
+	e, err := New(chip, Config{Lines: []Line{{Line: 7, Count: true}}})
+	require.NoError(t, err)
+	l := e.lines[0]
+	snapshot := func() (byte, uint64, uint64) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.value, l.rising, l.errors
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, _, n := snapshot(); n != 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	v, rising, n := snapshot()
+	// edge after dropped events is followed by fresh read
+	assert.Equal(t, byte(0), v)
+	assert.Equal(t, uint64(1), rising)
+	assert.True(t, n > 0 && n < 10, "errors=%d, repeated errors must back off", n)
+
+	assert.NoError(t, e.Close())
+	assert.True(t, gpio.IsClosed(e.Close()))
+	ev.AssertNumberOfCalls(t, "Close", 1)
+}
+
+func TestFormatLabels(t *testing.T) {
+	assert.Equal(t, `{a="1",b="x\"y\\z\n"}`, formatLabels("a", "1", "b", "x\"y\\z\n"))
+	assert.Equal(t, `{}`, formatLabels())
+}
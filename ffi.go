@@ -27,6 +27,10 @@ const (
 	GPIOLINE_FLAG_ACTIVE_LOW  LineFlag = 1 << 2
 	GPIOLINE_FLAG_OPEN_DRAIN  LineFlag = 1 << 3
 	GPIOLINE_FLAG_OPEN_SOURCE LineFlag = 1 << 4
+	// Linux 5.5+
+	GPIOLINE_FLAG_BIAS_PULL_UP   LineFlag = 1 << 5
+	GPIOLINE_FLAG_BIAS_PULL_DOWN LineFlag = 1 << 6
+	GPIOLINE_FLAG_BIAS_DISABLE   LineFlag = 1 << 7
 )
 
 // struct gpioline_info - Information about a certain GPIO line
@@ -48,6 +52,30 @@ type LineInfo struct {
 	Consumer [32]byte
 }
 
+type LineChangedType uint32
+
+const (
+	GPIOLINE_CHANGED_REQUESTED LineChangedType = 1
+	GPIOLINE_CHANGED_RELEASED  LineChangedType = 2
+	GPIOLINE_CHANGED_CONFIG    LineChangedType = 3
+)
+
+// struct gpioline_info_changed - Information about a change in status
+// of a GPIO line, Linux 5.7+
+type LineInfoChanged struct {
+	// updated line information
+	Info LineInfo
+
+	// estimate of time of status change occurrence, in nanoseconds
+	Timestamp uint64
+
+	// one of GPIOLINE_CHANGED_REQUESTED, GPIOLINE_CHANGED_RELEASED
+	// and GPIOLINE_CHANGED_CONFIG
+	EventType LineChangedType
+
+	_pad [5]uint32 //lint:ignore U1000 .
+}
+
 const GPIOHANDLES_MAX = 64
 
 type RequestFlag uint32
@@ -58,6 +86,12 @@ const (
 	GPIOHANDLE_REQUEST_ACTIVE_LOW  RequestFlag = 1 << 2
 	GPIOHANDLE_REQUEST_OPEN_DRAIN  RequestFlag = 1 << 3
 	GPIOHANDLE_REQUEST_OPEN_SOURCE RequestFlag = 1 << 4
+	// Linux 5.5+, require either INPUT or OUTPUT
+	GPIOHANDLE_REQUEST_BIAS_PULL_UP   RequestFlag = 1 << 5
+	GPIOHANDLE_REQUEST_BIAS_PULL_DOWN RequestFlag = 1 << 6
+	GPIOHANDLE_REQUEST_BIAS_DISABLE   RequestFlag = 1 << 7
+
+	requestBiasMask = GPIOHANDLE_REQUEST_BIAS_PULL_UP | GPIOHANDLE_REQUEST_BIAS_PULL_DOWN | GPIOHANDLE_REQUEST_BIAS_DISABLE
 )
 
 // struct gpiohandle_request - Information about a GPIO handle request
@@ -102,6 +136,20 @@ type HandleData struct {
 	Values [GPIOHANDLES_MAX]byte
 }
 
+// struct gpiohandle_config - Configuration for a GPIO handle request, Linux 5.5+
+type HandleConfig struct {
+	// updated flags for the requested GPIO lines, such as
+	// GPIOHANDLE_REQUEST_OUTPUT, GPIOHANDLE_REQUEST_ACTIVE_LOW etc, OR:ed together
+	Flags RequestFlag
+
+	// if the GPIOHANDLE_REQUEST_OUTPUT is set in flags,
+	// this specifies the default output value, should be 0 (low) or
+	// 1 (high), anything else than 0 or 1 will be interpreted as 1 (high)
+	DefaultValues [GPIOHANDLES_MAX]byte
+
+	_pad [4]uint32 //lint:ignore U1000 .
+}
+
 type EventFlag uint32
 
 const (
@@ -142,6 +190,7 @@ const (
 )
 
 // struct gpioevent_data - The actual event being pushed to userspace
+// High-level Eventer.Wait returns Event which embeds it.
 type EventData struct {
 	// best estimate of time of event occurrence, in nanoseconds
 	Timestamp uint64
@@ -160,6 +209,16 @@ func RawGetLineInfo(fd int, arg *LineInfo) error {
 	return ioctl(fd, GPIO_GET_LINEINFO_IOCTL, uintptr(unsafe.Pointer(arg)))
 }
 
+// Linux 5.7+
+func RawWatchLineInfo(fd int, arg *LineInfo) error {
+	return ioctl(fd, GPIO_GET_LINEINFO_WATCH_IOCTL, uintptr(unsafe.Pointer(arg)))
+}
+
+// Linux 5.7+, works for both v1 and v2 watch
+func RawUnwatchLineInfo(fd int, line uint32) error {
+	return ioctl(fd, GPIO_GET_LINEINFO_UNWATCH_IOCTL, uintptr(unsafe.Pointer(&line)))
+}
+
 func RawGetLineHandle(fd int, arg *HandleRequest) error {
 	return ioctl(fd, GPIO_GET_LINEHANDLE_IOCTL, uintptr(unsafe.Pointer(arg)))
 }
@@ -168,6 +227,10 @@ func RawGetLineEvent(fd int, arg *EventRequest) error {
 	return ioctl(fd, GPIO_GET_LINEEVENT_IOCTL, uintptr(unsafe.Pointer(arg)))
 }
 
+func RawSetLineConfig(fd int, arg *HandleConfig) error {
+	return ioctl(fd, GPIOHANDLE_SET_CONFIG_IOCTL, uintptr(unsafe.Pointer(arg)))
+}
+
 func RawGetLineValues(fd int, arg *HandleData) error {
 	return ioctl(fd, GPIOHANDLE_GET_LINE_VALUES_IOCTL, uintptr(unsafe.Pointer(arg)))
 }
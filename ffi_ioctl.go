@@ -10,4 +10,17 @@ const (
 	GPIO_GET_LINEEVENT_IOCTL         uintptr = 0xc030b404
 	GPIOHANDLE_GET_LINE_VALUES_IOCTL uintptr = 0xc040b408
 	GPIOHANDLE_SET_LINE_VALUES_IOCTL uintptr = 0xc040b409
+	GPIOHANDLE_SET_CONFIG_IOCTL      uintptr = 0xc054b40a // Linux 5.5+
+	GPIO_GET_LINEINFO_WATCH_IOCTL    uintptr = 0xc048b40b // Linux 5.7+
+	GPIO_GET_LINEINFO_UNWATCH_IOCTL  uintptr = 0xc004b40c // Linux 5.7+
+)
+
+// v2 ABI, Linux 5.10+
+const (
+	GPIO_V2_GET_LINEINFO_IOCTL       uintptr = 0xc100b405
+	GPIO_V2_GET_LINEINFO_WATCH_IOCTL uintptr = 0xc100b406
+	GPIO_V2_GET_LINE_IOCTL           uintptr = 0xc250b407
+	GPIO_V2_LINE_SET_CONFIG_IOCTL    uintptr = 0xc110b40d
+	GPIO_V2_LINE_GET_VALUES_IOCTL    uintptr = 0xc010b40e
+	GPIO_V2_LINE_SET_VALUES_IOCTL    uintptr = 0xc010b40f
 )
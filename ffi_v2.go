@@ -0,0 +1,261 @@
+package gpio
+
+import (
+	"unsafe"
+)
+
+// GPIO v2 character device ABI, Linux 5.10+
+// From <include/uapi/linux/gpio.h>
+// All __aligned_u64 fields happen to be naturally aligned,
+// so Go layout is the same on 32 and 64 bit platforms.
+
+const GPIO_V2_LINES_MAX = 64
+
+// The maximum number of configuration attributes associated with a line request.
+const GPIO_V2_LINE_NUM_ATTRS_MAX = 10
+
+type LineFlagV2 uint64
+
+const (
+	GPIO_V2_LINE_FLAG_USED                 LineFlagV2 = 1 << 0 /* line is not available for request */
+	GPIO_V2_LINE_FLAG_ACTIVE_LOW           LineFlagV2 = 1 << 1
+	GPIO_V2_LINE_FLAG_INPUT                LineFlagV2 = 1 << 2
+	GPIO_V2_LINE_FLAG_OUTPUT               LineFlagV2 = 1 << 3
+	GPIO_V2_LINE_FLAG_EDGE_RISING          LineFlagV2 = 1 << 4
+	GPIO_V2_LINE_FLAG_EDGE_FALLING         LineFlagV2 = 1 << 5
+	GPIO_V2_LINE_FLAG_OPEN_DRAIN           LineFlagV2 = 1 << 6
+	GPIO_V2_LINE_FLAG_OPEN_SOURCE          LineFlagV2 = 1 << 7
+	GPIO_V2_LINE_FLAG_BIAS_PULL_UP         LineFlagV2 = 1 << 8
+	GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN       LineFlagV2 = 1 << 9
+	GPIO_V2_LINE_FLAG_BIAS_DISABLED        LineFlagV2 = 1 << 10
+	GPIO_V2_LINE_FLAG_EVENT_CLOCK_REALTIME LineFlagV2 = 1 << 11
+	GPIO_V2_LINE_FLAG_EVENT_CLOCK_HTE      LineFlagV2 = 1 << 12
+)
+
+// struct gpio_v2_line_values - Values of GPIO lines
+type LineValues struct {
+	// a bitmap containing the value of the lines, set to 1 for active
+	// and 0 for inactive
+	Bits uint64
+
+	// a bitmap identifying the lines to get or set, with each bit
+	// number corresponding to the index into LineRequest.Offsets
+	Mask uint64
+}
+
+type LineAttrID uint32
+
+const (
+	GPIO_V2_LINE_ATTR_ID_FLAGS         LineAttrID = 1
+	GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES LineAttrID = 2
+	GPIO_V2_LINE_ATTR_ID_DEBOUNCE      LineAttrID = 3
+)
+
+// struct gpio_v2_line_attribute - a configurable attribute of a line
+type LineAttribute struct {
+	// attribute identifier with value from LineAttrID
+	ID LineAttrID
+
+	_pad uint32 //lint:ignore U1000 .
+
+	// union { flags; values; debounce_period_us }
+	// use accessor methods below
+	Value uint64
+}
+
+func (a *LineAttribute) Flags() LineFlagV2 { return LineFlagV2(a.Value) }
+func (a *LineAttribute) Values() uint64    { return a.Value }
+
+// debounce_period_us is __u32 at the start of the union
+func (a *LineAttribute) DebouncePeriodUs() uint32 {
+	return *(*uint32)(unsafe.Pointer(&a.Value))
+}
+
+func (a *LineAttribute) SetFlags(f LineFlagV2) {
+	a.ID = GPIO_V2_LINE_ATTR_ID_FLAGS
+	a.Value = uint64(f)
+}
+
+func (a *LineAttribute) SetValues(bits uint64) {
+	a.ID = GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES
+	a.Value = bits
+}
+
+func (a *LineAttribute) SetDebouncePeriodUs(us uint32) {
+	a.ID = GPIO_V2_LINE_ATTR_ID_DEBOUNCE
+	a.Value = 0
+	*(*uint32)(unsafe.Pointer(&a.Value)) = us
+}
+
+// struct gpio_v2_line_config_attribute - a configuration attribute
+// associated with one or more of the requested lines.
+type LineConfigAttribute struct {
+	// the configurable attribute
+	Attr LineAttribute
+
+	// a bitmap identifying the lines to which the attribute applies,
+	// with each bit number corresponding to the index into LineRequest.Offsets
+	Mask uint64
+}
+
+// struct gpio_v2_line_config - Configuration for GPIO lines
+type LineConfig struct {
+	// flags for the GPIO lines, with values from LineFlagV2, OR:ed together.
+	// This is the default for all requested lines but may be overridden
+	// for particular lines using Attrs.
+	Flags LineFlagV2
+
+	// the number of attributes in Attrs
+	NumAttrs uint32
+
+	_pad [5]uint32 //lint:ignore U1000 .
+
+	// the configuration attributes associated with the requested lines.
+	// Any attribute should only be associated with a particular line once.
+	// If an attribute is associated with a line multiple times then the first
+	// occurrence (i.e. lowest index) has precedence.
+	Attrs [GPIO_V2_LINE_NUM_ATTRS_MAX]LineConfigAttribute
+}
+
+// Appends attribute applied to lines in mask.
+// Returns false if there is no room left.
+func (lc *LineConfig) AddAttr(attr LineAttribute, mask uint64) bool {
+	if lc.NumAttrs >= GPIO_V2_LINE_NUM_ATTRS_MAX {
+		return false
+	}
+	lc.Attrs[lc.NumAttrs] = LineConfigAttribute{Attr: attr, Mask: mask}
+	lc.NumAttrs++
+	return true
+}
+
+// struct gpio_v2_line_request - Information about a request for GPIO lines
+type LineRequest struct {
+	// an array of desired lines, specified by offset index for the associated GPIO chip
+	Offsets [GPIO_V2_LINES_MAX]uint32
+
+	// a desired consumer label for the selected GPIO lines such as "my-bitbanged-relay"
+	Consumer [32]byte
+
+	// requested configuration for the lines
+	Config LineConfig
+
+	// number of lines requested in this request, i.e. the number of
+	// valid fields in Offsets, set to 1 to request a single line
+	NumLines uint32
+
+	// a suggested minimum number of line events that the kernel should
+	// buffer. This is only relevant if edge detection is enabled in the
+	// configuration. Note that this is only a suggested value and the kernel
+	// may allocate a larger buffer or cap the size of the buffer. If this
+	// field is zero then the buffer size defaults to a minimum of NumLines * 16.
+	EventBufferSize uint32
+
+	_pad [5]uint32 //lint:ignore U1000 .
+
+	// if successful this field will contain a valid anonymous file handle
+	// after a GPIO_V2_GET_LINE_IOCTL operation, zero or negative value means error
+	Fd int32
+}
+
+// struct gpio_v2_line_info - Information about a certain GPIO line
+type LineInfoV2 struct {
+	// the name of this GPIO line, such as the output pin of the line on
+	// the chip, a rail or a pin header name on a board, as specified by the
+	// GPIO chip, may be empty (i.e. Name[0] == 0)
+	Name [32]byte
+
+	// a functional name for the consumer of this GPIO line as set
+	// by whatever is using it, will be empty if there is no current user but
+	// may also be empty if the consumer doesn't set this up
+	Consumer [32]byte
+
+	// the local offset on this GPIO chip, fill this in when
+	// requesting the line information from the kernel
+	Offset uint32
+
+	// the number of attributes in Attrs
+	NumAttrs uint32
+
+	// flags for this GPIO line, with values from LineFlagV2, OR:ed together
+	Flags LineFlagV2
+
+	// the configuration attributes associated with the line
+	Attrs [GPIO_V2_LINE_NUM_ATTRS_MAX]LineAttribute
+
+	_pad [4]uint32 //lint:ignore U1000 .
+}
+
+const (
+	GPIO_V2_LINE_CHANGED_REQUESTED LineChangedType = 1
+	GPIO_V2_LINE_CHANGED_RELEASED  LineChangedType = 2
+	GPIO_V2_LINE_CHANGED_CONFIG    LineChangedType = 3
+)
+
+// struct gpio_v2_line_info_changed - Information about a change in status
+// of a GPIO line
+type LineInfoChangedV2 struct {
+	// updated line information
+	Info LineInfoV2
+
+	// estimate of time of status change occurrence, in nanoseconds
+	TimestampNs uint64
+
+	// the type of change with a value from LineChangedType
+	EventType LineChangedType
+
+	_pad [5]uint32 //lint:ignore U1000 .
+}
+
+type LineEventID uint32
+
+const (
+	GPIO_V2_LINE_EVENT_RISING_EDGE  LineEventID = 1
+	GPIO_V2_LINE_EVENT_FALLING_EDGE LineEventID = 2
+)
+
+// struct gpio_v2_line_event - The actual event being pushed to userspace
+type LineEvent struct {
+	// best estimate of time of event occurrence, in nanoseconds.
+	// By default CLOCK_MONOTONIC, see GPIO_V2_LINE_FLAG_EVENT_CLOCK_*
+	TimestampNs uint64
+
+	// event identifier with value from LineEventID
+	ID LineEventID
+
+	// the offset of the line that triggered the event
+	Offset uint32
+
+	// the sequence number for this event in the sequence of events for
+	// all the lines in this line request
+	Seqno uint32
+
+	// the sequence number for this event in the sequence of
+	// events on this particular line
+	LineSeqno uint32
+
+	_pad [6]uint32 //lint:ignore U1000 .
+}
+
+func RawGetLineInfoV2(fd int, arg *LineInfoV2) error {
+	return ioctl(fd, GPIO_V2_GET_LINEINFO_IOCTL, uintptr(unsafe.Pointer(arg)))
+}
+
+func RawWatchLineInfoV2(fd int, arg *LineInfoV2) error {
+	return ioctl(fd, GPIO_V2_GET_LINEINFO_WATCH_IOCTL, uintptr(unsafe.Pointer(arg)))
+}
+
+func RawGetLineV2(fd int, arg *LineRequest) error {
+	return ioctl(fd, GPIO_V2_GET_LINE_IOCTL, uintptr(unsafe.Pointer(arg)))
+}
+
+func RawSetLineConfigV2(fd int, arg *LineConfig) error {
+	return ioctl(fd, GPIO_V2_LINE_SET_CONFIG_IOCTL, uintptr(unsafe.Pointer(arg)))
+}
+
+func RawGetLineValuesV2(fd int, arg *LineValues) error {
+	return ioctl(fd, GPIO_V2_LINE_GET_VALUES_IOCTL, uintptr(unsafe.Pointer(arg)))
+}
+
+func RawSetLineValuesV2(fd int, arg *LineValues) error {
+	return ioctl(fd, GPIO_V2_LINE_SET_VALUES_IOCTL, uintptr(unsafe.Pointer(arg)))
+}
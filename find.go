@@ -0,0 +1,157 @@
+package gpio
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Named line found on system, see FindLine.
+type LineLocation struct {
+	Chip   ChipEntry
+	Offset uint32
+}
+
+// Returned when line name matches more than one line.
+// Names are assigned by device tree or driver and nothing prevents duplicates.
+type DuplicateLineError struct {
+	Name  string
+	Found []LineLocation
+}
+
+func (e *DuplicateLineError) Error() string {
+	places := make([]string, len(e.Found))
+	for i, l := range e.Found {
+		places[i] = fmt.Sprintf("%s:%d", l.Chip.Path, l.Offset)
+	}
+	return fmt.Sprintf("line name=%s is not unique, found at %s", e.Name, strings.Join(places, " "))
+}
+
+func IsDuplicateLine(err error) bool {
+	_, ok := errors.Cause(err).(*DuplicateLineError)
+	return ok
+}
+
+// Finds chip and offset of line by name across all chips, like gpiofind.
+// Chips which can't be read are skipped and listed in NotFound error.
+// Missing name returns NotFound error (check with errors.IsNotFound),
+// more than one match returns *DuplicateLineError.
+func FindLine(name string) (LineLocation, error) { return FindLineAt("/", name) }
+
+// Same as FindLine with `root` in place of "/", see ListChipsAt.
+func FindLineAt(root, name string) (LineLocation, error) {
+	const tag = "FindLine"
+	chips, err := ListChipsAt(root)
+	if err != nil {
+		return LineLocation{}, errors.Annotate(err, tag)
+	}
+	var found []LineLocation
+	var skipped []string
+	for _, c := range chips {
+		if c.Err != nil {
+			skipped = append(skipped, c.Path)
+			continue
+		}
+		names, err := readLineNames(c)
+		if err != nil {
+			// same as unreadable chip in ListChips, don't fail whole search
+			skipped = append(skipped, c.Path)
+			continue
+		}
+		for offset, n := range names {
+			if n != "" && n == name {
+				found = append(found, LineLocation{Chip: c, Offset: uint32(offset)})
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		if len(skipped) != 0 {
+			return LineLocation{}, errors.NotFoundf("line name=%s, unreadable chips %s", name, strings.Join(skipped, " "))
+		}
+		return LineLocation{}, errors.NotFoundf("line name=%s", name)
+	case 1:
+		return found[0], nil
+	}
+	return LineLocation{}, &DuplicateLineError{Name: name, Found: found}
+}
+
+// Resolves line names to offsets on this chip, in the same order.
+// Repeated name is NotValid, kernel would reject such request anyway.
+// Makes LineInfo syscall for each line of chip.
+func (c *chip) FindLines(names ...string) ([]uint32, error) {
+	chipNames, err := c.lineNames()
+	if err != nil {
+		return nil, errors.Annotate(err, "FindLines")
+	}
+	return MatchLineNames(ChipEntry{Path: c.path, Info: c.info}, chipNames, names...)
+}
+
+// Chiper.FindLines rules over line names of one chip, indexed by offset.
+// Exported for Chiper implementations, `chip` is reported in errors.
+func MatchLineNames(chip ChipEntry, lineNames []string, names ...string) ([]uint32, error) {
+	if err := checkRepeatedNames(names); err != nil {
+		return nil, err
+	}
+	offsets := make([]uint32, len(names))
+	for i, name := range names {
+		var found []LineLocation
+		for offset, n := range lineNames {
+			if n != "" && n == name {
+				found = append(found, LineLocation{Chip: chip, Offset: uint32(offset)})
+			}
+		}
+		switch len(found) {
+		case 0:
+			return nil, errors.NotFoundf("line name=%s chip=%s", name, chip.Name())
+		case 1:
+			offsets[i] = found[0].Offset
+		default:
+			return nil, &DuplicateLineError{Name: name, Found: found}
+		}
+	}
+	return offsets, nil
+}
+
+// Same as OpenLines with line names instead of offsets.
+func (c *chip) OpenLinesByName(flag RequestFlag, consumerLabel string, names ...string) (Lineser, error) {
+	offsets, err := c.FindLines(names...)
+	if err != nil {
+		return nil, err
+	}
+	return c.OpenLines(flag, consumerLabel, offsets...)
+}
+
+func checkRepeatedNames(names []string) error {
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, ok := seen[name]; ok {
+			return errors.NotValidf("line name=%s repeated", name)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
+func (c *chip) lineNames() ([]string, error) {
+	names := make([]string, c.info.Lines)
+	for i := range names {
+		li, err := c.LineInfo(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		names[i] = li.NameString()
+	}
+	return names, nil
+}
+
+// variable for tests with fake tree
+var readLineNames = func(e ChipEntry) ([]string, error) {
+	c, err := Open(e.Path, "")
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.(*chip).lineNames()
+}
@@ -2,6 +2,8 @@ package gpio
 
 import (
 	"fmt"
+	"os"
+	"sync"
 	"sync/atomic"
 	"syscall"
 
@@ -10,28 +12,37 @@ import (
 
 type chip struct {
 	fa              fdArc
+	path            string
 	defaultConsumer string
 	closed          uint32
 	info            ChipInfo
+	v2              bool
+	watching        uint32
 }
 
 // The entry point to this library.
 // `path` is likely "/dev/gpiochipN"
 // `defaultConsumer` will be used in absence of more specific consumer label
 //   to OpenLines/GetLineEvent.
-// Makes two syscalls: open(path), ioctl(GET_CHIPINFO)
+// Makes three syscalls: open(path), ioctl(GET_CHIPINFO), ioctl(V2_GET_LINEINFO)
+// The last one probes for v2 ABI (Linux 5.10+) which is then used for all
+// line requests. Kernels without it fall back to deprecated v1 ABI.
 // You must call Chiper.Close()
 func Open(path, defaultConsumer string) (Chiper, error) {
-	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	fd, err := syscall.Open(path, chipOpenFlags, 0)
 	if err != nil {
 		return nil, err
 	}
 	chip := &chip{
 		fa:              newFdArc(fd),
+		path:            path,
 		defaultConsumer: defaultConsumer,
 	}
 	// runtime.SetFinalizer(chip, func(c *chip) { c.Close() })
 	err = RawGetChipInfo(chip.fa.fd, &chip.info)
+	if err == nil {
+		chip.v2 = probeV2(chip.fa.fd, chip.info.Lines)
+	}
 	return chip, err
 }
 
@@ -49,28 +60,59 @@ func (c *chip) Close() error {
 func (c *chip) Info() ChipInfo { return c.info }
 
 func (c *chip) LineInfo(line uint32) (LineInfo, error) {
+	if c.v2 {
+		return c.lineInfoV2(line)
+	}
 	linfo := LineInfo{LineOffset: line}
 	err := RawGetLineInfo(c.fa.fd, &linfo)
 	return linfo, err
 }
 
 func (c *chip) OpenLines(flag RequestFlag, consumerLabel string, offsets ...uint32) (Lineser, error) {
+	return c.OpenLinesWith(flag, consumerLabel, LineOptions{}, offsets...)
+}
+
+// Same as OpenLines with extra options.
+// `opt.DefaultValues` are applied by kernel in the same syscall which requests
+// output lines, so they never glitch through low level.
+// `opt.Debounce` requires v2 ABI, there is no software fallback for Read().
+func (c *chip) OpenLinesWith(flag RequestFlag, consumerLabel string, opt LineOptions, offsets ...uint32) (Lineser, error) {
 	const tag = "GET_LINEHANDLE"
+	if err := flag.Check(); err != nil {
+		return nil, err
+	}
+	if len(opt.DefaultValues) > len(offsets) {
+		return nil, errors.NotValidf("DefaultValues len=%d for lines=%d", len(opt.DefaultValues), len(offsets))
+	}
+	if err := checkDebounce(opt.Debounce); err != nil {
+		return nil, err
+	}
+	if opt.Debounce != 0 && flag&GPIOHANDLE_REQUEST_INPUT == 0 {
+		return nil, errors.NotValidf("flags=%x Debounce without INPUT", uint32(flag))
+	}
 	if !c.fa.incref() {
 		return nil, ErrClosed
 	}
+	if c.v2 {
+		return c.openLinesV2(flag, consumerLabel, opt, offsets)
+	}
+	if opt.Debounce != 0 {
+		c.fa.decref()
+		return nil, errors.NotSupportedf("%s Debounce on v1 ABI, use GetLineEventWith", tag)
+	}
 
 	req := HandleRequest{
 		Flags: flag,
 		Lines: uint32(len(offsets)),
 	}
-	copy(req.ConsumerLabel[:], []byte(consumerLabel))
+	copy(req.ConsumerLabel[:], []byte(c.consumer(consumerLabel)))
 	copy(req.LineOffsets[:], offsets)
+	copy(req.DefaultValues[:], opt.DefaultValues)
 
 	err := RawGetLineHandle(c.fa.fd, &req)
 	if err != nil {
 		c.fa.decref()
-		err = errors.Annotate(err, tag)
+		err = annotateRequest(err, tag, flag, offsets)
 		return nil, err
 	}
 	if req.Fd <= 0 {
@@ -85,10 +127,53 @@ func (c *chip) OpenLines(flag RequestFlag, consumerLabel string, offsets ...uint
 		count: req.Lines,
 	}
 	copy(lh.offsets[:], req.LineOffsets[:])
+	copy(lh.values[:], req.DefaultValues[:])
 	// runtime.SetFinalizer(lh, func(l *lines) { l.Close() })
 	return lh, nil
 }
 
+// Same for Open and ListChips, so listed chip without Err can be opened.
+const chipOpenFlags = syscall.O_RDWR | syscall.O_CLOEXEC
+
+func (c *chip) consumer(label string) string {
+	if label == "" {
+		return c.defaultConsumer
+	}
+	return label
+}
+
+// Catches flag combinations which kernel would reject with bare EINVAL.
+// Called by every request and SetConfig, exported for Chiper implementations.
+func (f RequestFlag) Check() error {
+	if f&GPIOHANDLE_REQUEST_INPUT != 0 && f&GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		return errors.NotValidf("flags=%x both INPUT and OUTPUT", uint32(f))
+	}
+	bias := f & requestBiasMask
+	if bias&(bias-1) != 0 {
+		return errors.NotValidf("flags=%x more than one BIAS", uint32(f))
+	}
+	if bias != 0 && f&(GPIOHANDLE_REQUEST_INPUT|GPIOHANDLE_REQUEST_OUTPUT) == 0 {
+		return errors.NotValidf("flags=%x BIAS without INPUT or OUTPUT", uint32(f))
+	}
+	return nil
+}
+
+// Adds lines and flags of failed request, same for v1 and v2 ABI.
+// Explains EINVAL from older kernels which don't know bias flags.
+func annotateRequest(err error, tag string, flag RequestFlag, lines []uint32) error {
+	if flag&requestBiasMask != 0 && isErrno(err, syscall.EINVAL) {
+		return errors.Annotatef(err, "%s lines=%v flags=%x kernel rejected BIAS flags, requires Linux 5.5+", tag, lines, uint32(flag))
+	}
+	return errors.Annotatef(err, "%s lines=%v flags=%x", tag, lines, uint32(flag))
+}
+
+func isErrno(err error, errno syscall.Errno) bool {
+	if se, ok := errors.Cause(err).(*os.SyscallError); ok {
+		return se.Err == errno
+	}
+	return false
+}
+
 func (self *ChipInfo) String() string {
 	return fmt.Sprintf("name=%s label=%s lines=%d",
 		cstr(self.Name[:]), cstr(self.Label[:]), self.Lines)
@@ -97,18 +182,34 @@ func (self *ChipInfo) String() string {
 func (li *LineInfo) ConsumerString() string { return cstr(li.Consumer[:]) }
 func (li *LineInfo) NameString() string     { return cstr(li.Name[:]) }
 
+// Returns "pull-up", "pull-down", "disabled" or "unknown" when kernel
+// doesn't report bias (before Linux 5.5 or line configured as-is).
+func (li *LineInfo) Bias() string {
+	switch {
+	case li.Flags&GPIOLINE_FLAG_BIAS_PULL_UP != 0:
+		return "pull-up"
+	case li.Flags&GPIOLINE_FLAG_BIAS_PULL_DOWN != 0:
+		return "pull-down"
+	case li.Flags&GPIOLINE_FLAG_BIAS_DISABLE != 0:
+		return "disabled"
+	}
+	return "unknown"
+}
+
 func (li *LineInfo) String() string {
-	return fmt.Sprintf("line=%d flags=%x name=%s consumer=%s",
-		li.LineOffset, li.Flags, li.NameString(), li.ConsumerString())
+	return fmt.Sprintf("line=%d flags=%x bias=%s name=%s consumer=%s",
+		li.LineOffset, li.Flags, li.Bias(), li.NameString(), li.ConsumerString())
 }
 
 type lines struct {
 	chip    *chip
 	fd      int
 	offsets [GPIOHANDLES_MAX]uint32
+	mu      sync.Mutex // guards values and hardware read-modify-write
 	values  [GPIOHANDLES_MAX]byte
 	count   uint32
 	closed  uint32
+	v2      bool
 }
 
 func (self *lines) Close() error {
@@ -138,7 +239,9 @@ func (self *lines) mustFindLine(line uint32) int {
 func (self *lines) SetFunc(line uint32) LineSetFunc {
 	idx := self.mustFindLine(line)
 	return func(value byte) {
+		self.mu.Lock()
 		self.values[idx] = value
+		self.mu.Unlock()
 	}
 }
 
@@ -148,17 +251,129 @@ func (self *lines) LineOffsets() []uint32 {
 
 func (self *lines) Read() (HandleData, error) {
 	data := HandleData{}
+	if self.v2 {
+		lv := LineValues{Mask: MaskAll(self.count)}
+		err := RawGetLineValuesV2(self.fd, &lv)
+		BitsToValues(lv.Bits, data.Values[:self.count])
+		return data, err
+	}
 	err := RawGetLineValues(self.fd, &data)
 	return data, err
 }
 
 func (self *lines) Flush() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.v2 {
+		lv := LineValues{
+			Bits: ValuesToBits(self.values[:self.count]),
+			Mask: MaskAll(self.count),
+		}
+		return RawSetLineValuesV2(self.fd, &lv)
+	}
 	data := HandleData{Values: self.values}
 	return RawSetLineValues(self.fd, &data)
 }
 
 // Changes internal buffer only, use `.Flush()` to apply to hardware.
-func (self *lines) SetBulk(bs ...byte) { copy(self.values[:], bs) }
+func (self *lines) SetBulk(bs ...byte) {
+	self.mu.Lock()
+	copy(self.values[:], bs)
+	self.mu.Unlock()
+}
+
+// Reads only lines selected by mask, bit i is LineOffsets()[i].
+// Returned bits outside of mask are zero.
+func (self *lines) GetValues(mask uint64) (uint64, error) {
+	mask &= MaskAll(self.count)
+	if self.v2 {
+		lv := LineValues{Mask: mask}
+		err := RawGetLineValuesV2(self.fd, &lv)
+		return lv.Bits & mask, err
+	}
+	data, err := self.Read()
+	return ValuesToBits(data.Values[:self.count]) & mask, err
+}
+
+// Changes only lines selected by mask to corresponding bits, bit i is LineOffsets()[i].
+// Unlike SetBulk+Flush, this is safe for many owners of different lines
+// in one handle. v2 ABI writes only masked lines, with v1 ABI it is
+// locked read-modify-write of all lines. Internal buffer is updated too.
+func (self *lines) SetValues(mask, bits uint64) error {
+	const tag = "SetValues"
+	mask &= MaskAll(self.count)
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	var err error
+	if self.v2 {
+		lv := LineValues{Bits: bits & mask, Mask: mask}
+		err = RawSetLineValuesV2(self.fd, &lv)
+	} else {
+		var data HandleData
+		if err = RawGetLineValues(self.fd, &data); err != nil {
+			return errors.Annotate(err, tag)
+		}
+		current := ValuesToBits(data.Values[:self.count])
+		BitsToValues((current&^mask)|(bits&mask), data.Values[:self.count])
+		err = RawSetLineValues(self.fd, &data)
+	}
+	if err != nil {
+		return errors.Annotate(err, tag)
+	}
+	for i := uint32(0); i < self.count; i++ {
+		if mask&(1<<i) != 0 {
+			self.values[i] = byte((bits >> i) & 1)
+		}
+	}
+	return nil
+}
+
+// Changes direction, active-low, drive and bias flags of all lines
+// without releasing them, Linux 5.5+
+// For OUTPUT, lines are driven to `defaultValues` if provided,
+// otherwise to current internal buffer (last SetBulk/SetFunc) so switching
+// back to output doesn't glitch.
+// For INPUT, internal buffer is refreshed from hardware.
+func (self *lines) SetConfig(flag RequestFlag, defaultValues ...byte) error {
+	const tag = "SET_CONFIG"
+	if err := flag.Check(); err != nil {
+		return err
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	// buffer changes only if kernel accepted config
+	values := self.values
+	if flag&GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		copy(values[:self.count], defaultValues)
+	}
+
+	var err error
+	if self.v2 {
+		lc := LineConfig{Flags: flag.V2()}
+		if flag&GPIOHANDLE_REQUEST_OUTPUT != 0 {
+			var attr LineAttribute
+			attr.SetValues(ValuesToBits(values[:self.count]))
+			lc.AddAttr(attr, MaskAll(self.count))
+		}
+		err = RawSetLineConfigV2(self.fd, &lc)
+	} else {
+		hc := HandleConfig{Flags: flag, DefaultValues: values}
+		err = RawSetLineConfig(self.fd, &hc)
+	}
+	if err != nil {
+		return annotateRequest(err, tag, flag, self.LineOffsets())
+	}
+	self.values = values
+
+	if flag&GPIOHANDLE_REQUEST_INPUT != 0 {
+		data, err := self.Read()
+		if err != nil {
+			return errors.Annotate(err, tag)
+		}
+		copy(self.values[:self.count], data.Values[:self.count])
+	}
+	return nil
+}
 
 func cstr(bs []byte) string {
 	length := 0
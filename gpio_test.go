@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -179,3 +180,150 @@ func TestGPIOEvent(t *testing.T) {
 	assert.Less(timeDiff.Nanoseconds(), int64(time.Second*9), "should trigger before wait timer is over")
 
 }
+
+func TestGPIODefaultValues(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	if !testConfig.hasLoopback {
+		t.Skip("default values test requires loopback")
+	}
+	chiper, err := Open(testConfig.gpioDev, "go-test-default")
+	require.NoError(err)
+	defer chiper.Close()
+
+	readLines, err := chiper.OpenLines(GPIOHANDLE_REQUEST_INPUT, "go-test-in", testConfig.gpioIn)
+	require.NoError(err)
+	defer readLines.Close()
+
+	writeLines, err := chiper.OpenLinesWith(GPIOHANDLE_REQUEST_OUTPUT, "go-test-out",
+		LineOptions{DefaultValues: []byte{1}}, testConfig.gpioOut)
+	require.NoError(err)
+	defer writeLines.Close()
+
+	data, err := readLines.Read()
+	assert.NoError(err)
+	assert.Equal(byte(1), data.Values[0], "output should come up high")
+
+	// Flush must not undo default value
+	err = writeLines.Flush()
+	assert.NoError(err)
+	data, err = readLines.Read()
+	assert.NoError(err)
+	assert.Equal(byte(1), data.Values[0], "output should stay high after Flush")
+}
+
+func TestGPIOWatchLineInfo(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	if !testConfig.hasGpio {
+		t.Skip("watch test requires gpio")
+	}
+	chiper, err := Open(testConfig.gpioDev, "go-test-watch")
+	require.NoError(err)
+	defer chiper.Close()
+
+	w, err := chiper.WatchLineInfo(testConfig.gpioIn)
+	require.NoError(err, "WatchLineInfo should succeed")
+	defer w.Close()
+	_, err = chiper.WatchLineInfo(testConfig.gpioIn)
+	assert.Error(err, "second watcher should fail")
+
+	chiper2, err := Open(testConfig.gpioDev, "go-test-watch-other")
+	require.NoError(err)
+	defer chiper2.Close()
+	lines, err := chiper2.OpenLines(GPIOHANDLE_REQUEST_INPUT, "go-test-watched", testConfig.gpioIn)
+	require.NoError(err)
+
+	change, err := w.Wait(time.Second)
+	require.NoError(err, "Wait should succeed")
+	assert.Equal(GPIOLINE_CHANGED_REQUESTED, change.EventType)
+	assert.Equal("go-test-watched", change.Info.ConsumerString())
+
+	require.NoError(lines.Close())
+	change, err = w.Wait(time.Second)
+	require.NoError(err, "Wait should succeed")
+	assert.Equal(GPIOLINE_CHANGED_RELEASED, change.EventType)
+
+	assert.NoError(w.Unwatch(testConfig.gpioIn))
+	_, err = w.Wait(10 * time.Millisecond)
+	assert.True(IsTimeout(err))
+}
+
+func TestWatchCloseRace(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		fd, err := syscall.Dup(int(w.Fd()))
+		require.NoError(t, err)
+		c := &chip{fa: newFdArc(fd), watching: 1}
+		c.fa.incref()
+		lw := &lineWatcher{chip: c, f: r, watched: make(map[uint32]struct{})}
+		done := make(chan struct{})
+		go func() {
+			_ = lw.Close()
+			close(done)
+		}()
+		// not gpio fd, ioctl fails with ENOTTY if Watch wins
+		_, err = lw.Watch(1)
+		assert.Error(t, err)
+		<-done
+		assert.Equal(t, ErrClosed, lw.Unwatch(1))
+		_, err = lw.Watch(1)
+		assert.Equal(t, ErrClosed, err)
+		c.fa.decref()
+		require.NoError(t, c.fa.wait())
+		w.Close()
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	now := time.Now()
+	e := Event{EventData: EventData{Timestamp: MonotonicNow() - uint64(time.Second)}, Clock: EventClockMonotonic}
+	assert.WithinDuration(t, now.Add(-time.Second), e.Time(), 50*time.Millisecond)
+
+	e = Event{EventData: EventData{Timestamp: uint64(now.UnixNano())}, Clock: EventClockRealtime}
+	assert.True(t, e.Time().Equal(time.Unix(0, now.UnixNano())))
+}
+
+func TestGPIOLinesEvent(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	if !testConfig.hasLoopback {
+		t.Skip("event test requires loopback")
+	}
+	chiper, err := Open(testConfig.gpioDev, "go-test-lines-event")
+	require.NoError(err)
+	defer chiper.Close()
+	if !chiper.(*chip).v2 {
+		t.Skip("multi-line events require v2 ABI")
+	}
+
+	writeLines, err := chiper.OpenLines(GPIOHANDLE_REQUEST_OUTPUT, "go-test-ev-out", testConfig.gpioOut)
+	require.NoError(err)
+	defer writeLines.Close()
+
+	ev, err := chiper.GetLinesEvent([]uint32{testConfig.gpioIn}, 0, GPIOEVENT_REQUEST_RISING_EDGE, "go-test-ev-in", EventOptions{})
+	require.NoError(err)
+	defer ev.Close()
+
+	writeLines.SetBulk(1)
+	require.NoError(writeLines.Flush())
+	e, err := ev.Wait(time.Second)
+	require.NoError(err)
+	assert.Equal(testConfig.gpioIn, e.LineOffset)
+	assert.Equal(uint32(1), e.Seqno)
+}
+
+func TestSetConfigFailedKeepsBuffer(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+	for _, v2 := range []bool{false, true} {
+		// not gpio fd, ioctl fails with ENOTTY
+		l := &lines{fd: int(w.Fd()), count: 2, v2: v2}
+		l.values[0], l.values[1] = 1, 0
+		assert.Error(t, l.SetConfig(GPIOHANDLE_REQUEST_OUTPUT, 0, 1))
+		assert.Equal(t, []byte{1, 0}, l.values[:2], "v2=%t", v2)
+	}
+}
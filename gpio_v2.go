@@ -0,0 +1,260 @@
+package gpio
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/juju/errors"
+)
+
+// High-level Chiper/Lineser/Eventer on top of v2 ABI.
+// Public API and semantics stay same as with v1, only ioctls differ.
+
+// Returns true if kernel understands GPIO_V2_GET_LINEINFO_IOCTL.
+// Without CONFIG_GPIO_CDEV_V1 v1 ioctls return EINVAL, with v1 only - v2 ioctls do.
+func probeV2(fd int, lineCount uint32) bool {
+	if lineCount == 0 {
+		return false
+	}
+	li := LineInfoV2{Offset: 0}
+	return RawGetLineInfoV2(fd, &li) == nil
+}
+
+func (c *chip) lineInfoV2(line uint32) (LineInfo, error) {
+	li := LineInfoV2{Offset: line}
+	err := RawGetLineInfoV2(c.fa.fd, &li)
+	return li.LineInfo(), err
+}
+
+// Caller must incref chip.
+func (c *chip) openLinesV2(flag RequestFlag, consumerLabel string, opt LineOptions, offsets []uint32) (Lineser, error) {
+	const tag = "GPIO_V2_GET_LINE"
+	req := LineRequest{NumLines: uint32(len(offsets))}
+	req.Config.Flags = flag.V2()
+	copy(req.Consumer[:], []byte(c.consumer(consumerLabel)))
+	copy(req.Offsets[:], offsets)
+	if flag&GPIOHANDLE_REQUEST_OUTPUT != 0 && len(opt.DefaultValues) != 0 {
+		var attr LineAttribute
+		attr.SetValues(ValuesToBits(opt.DefaultValues))
+		req.Config.AddAttr(attr, MaskAll(uint32(len(opt.DefaultValues))))
+	}
+	addDebounce(&req.Config, opt.Debounce, req.NumLines)
+
+	fd, err := c.requestV2(tag, &req, flag)
+	if err != nil {
+		return nil, err
+	}
+	lh := &lines{
+		chip:  c,
+		fd:    fd,
+		count: req.NumLines,
+		v2:    true,
+	}
+	copy(lh.offsets[:], req.Offsets[:])
+	copy(lh.values[:], opt.DefaultValues)
+	return lh, nil
+}
+
+// Caller must incref chip.
+func (c *chip) getLineEventV2(lines []uint32, flag RequestFlag, events EventFlag, consumerLabel string, opt EventOptions) (Eventer, error) {
+	const tag = "GPIO_V2_GET_LINE"
+	req := LineRequest{NumLines: uint32(len(lines))}
+	copy(req.Offsets[:], lines)
+	req.Config.Flags = (GPIOHANDLE_REQUEST_INPUT | flag).V2() | events.V2()
+	copy(req.Consumer[:], []byte(c.consumer(consumerLabel)))
+	addDebounce(&req.Config, opt.Debounce, req.NumLines)
+	req.Config.Flags |= opt.Clock.V2()
+	req.EventBufferSize = opt.BufferSize
+
+	fd, err := c.requestV2(tag, &req, GPIOHANDLE_REQUEST_INPUT|flag)
+	if err != nil {
+		if opt.Clock != EventClockMonotonic && isErrno(err, syscall.EINVAL) {
+			err = errors.Annotatef(err, "Clock=%s requires Linux 5.11+ (realtime) or 6.0+ (hte)", opt.Clock)
+		}
+		return nil, err
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		_ = syscall.Close(fd)
+		c.fa.decref()
+		err = errors.Annotate(err, "SetNonblock")
+		return nil, err
+	}
+
+	le := &lineEvent{
+		chip:    c,
+		f:       os.NewFile(uintptr(fd), fmt.Sprintf("gpio:event:%v", lines)),
+		reqFlag: GPIOHANDLE_REQUEST_INPUT | flag,
+		events:  events,
+		line:    lines[0],
+		v2:      true,
+		clock:   opt.Clock,
+		bufSize: EventBufferSizeV2(opt.BufferSize, req.NumLines),
+	}
+	return le, nil
+}
+
+// Performs GPIO_V2_GET_LINE_IOCTL, on error releases chip reference.
+// `flag` is only for error context, request carries translated flags.
+func (c *chip) requestV2(tag string, req *LineRequest, flag RequestFlag) (int, error) {
+	err := RawGetLineV2(c.fa.fd, req)
+	if err != nil {
+		c.fa.decref()
+		err = annotateRequest(err, tag, flag, req.Offsets[:req.NumLines])
+		return -1, err
+	}
+	if req.Fd <= 0 {
+		c.fa.decref()
+		err = errors.Errorf("%s ioctl=success fd=%d", tag, req.Fd)
+		return -1, err
+	}
+	return int(req.Fd), nil
+}
+
+func (self *lineEvent) readEventV2() (Event, error) {
+	const esz = int(unsafe.Sizeof(LineEvent{}))
+	type eventBuf [esz]byte
+	var buf eventBuf
+	var le LineEvent
+	var e Event
+	if err := readFixed(self.f, buf[:]); err != nil {
+		return e, err
+	}
+	eb := (*eventBuf)(unsafe.Pointer(&le))
+	copy((*eb)[:], buf[:])
+	e.Timestamp = le.TimestampNs
+	e.ID = EventID(le.ID)
+	e.Seqno = le.Seqno
+	e.LineSeqno = le.LineSeqno
+	e.LineOffset = le.Offset
+	// kernel silently discards events when buffer is full,
+	// which shows as gap in sequence; uint32 wrap-around is fine
+	if gap := le.Seqno - self.seqno - 1; gap != 0 {
+		atomic.AddUint64(&self.dropped, uint64(gap))
+	}
+	self.seqno = le.Seqno
+	return e, nil
+}
+
+// Kernel resolution is microseconds, caller must checkDebounce first.
+func addDebounce(lc *LineConfig, d time.Duration, count uint32) {
+	if d == 0 {
+		return
+	}
+	var attr LineAttribute
+	attr.SetDebouncePeriodUs(uint32(d / time.Microsecond))
+	lc.AddAttr(attr, MaskAll(count))
+}
+
+// Translates v1 request flags to v2 line flags.
+func (f RequestFlag) V2() LineFlagV2 {
+	var r LineFlagV2
+	if f&GPIOHANDLE_REQUEST_INPUT != 0 {
+		r |= GPIO_V2_LINE_FLAG_INPUT
+	}
+	if f&GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		r |= GPIO_V2_LINE_FLAG_OUTPUT
+	}
+	if f&GPIOHANDLE_REQUEST_ACTIVE_LOW != 0 {
+		r |= GPIO_V2_LINE_FLAG_ACTIVE_LOW
+	}
+	if f&GPIOHANDLE_REQUEST_OPEN_DRAIN != 0 {
+		r |= GPIO_V2_LINE_FLAG_OPEN_DRAIN
+	}
+	if f&GPIOHANDLE_REQUEST_OPEN_SOURCE != 0 {
+		r |= GPIO_V2_LINE_FLAG_OPEN_SOURCE
+	}
+	if f&GPIOHANDLE_REQUEST_BIAS_PULL_UP != 0 {
+		r |= GPIO_V2_LINE_FLAG_BIAS_PULL_UP
+	}
+	if f&GPIOHANDLE_REQUEST_BIAS_PULL_DOWN != 0 {
+		r |= GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN
+	}
+	if f&GPIOHANDLE_REQUEST_BIAS_DISABLE != 0 {
+		r |= GPIO_V2_LINE_FLAG_BIAS_DISABLED
+	}
+	return r
+}
+
+// Translates v1 event flags to v2 line flags.
+func (f EventFlag) V2() LineFlagV2 {
+	var r LineFlagV2
+	if f&GPIOEVENT_REQUEST_RISING_EDGE != 0 {
+		r |= GPIO_V2_LINE_FLAG_EDGE_RISING
+	}
+	if f&GPIOEVENT_REQUEST_FALLING_EDGE != 0 {
+		r |= GPIO_V2_LINE_FLAG_EDGE_FALLING
+	}
+	return r
+}
+
+// Translates v2 line flags to v1 line info flags.
+// Edge detection and event clock have no v1 equivalent and are dropped.
+func (f LineFlagV2) V1() LineFlag {
+	var r LineFlag
+	if f&GPIO_V2_LINE_FLAG_USED != 0 {
+		r |= GPIOLINE_FLAG_KERNEL
+	}
+	if f&GPIO_V2_LINE_FLAG_OUTPUT != 0 {
+		r |= GPIOLINE_FLAG_IS_OUT
+	}
+	if f&GPIO_V2_LINE_FLAG_ACTIVE_LOW != 0 {
+		r |= GPIOLINE_FLAG_ACTIVE_LOW
+	}
+	if f&GPIO_V2_LINE_FLAG_OPEN_DRAIN != 0 {
+		r |= GPIOLINE_FLAG_OPEN_DRAIN
+	}
+	if f&GPIO_V2_LINE_FLAG_OPEN_SOURCE != 0 {
+		r |= GPIOLINE_FLAG_OPEN_SOURCE
+	}
+	if f&GPIO_V2_LINE_FLAG_BIAS_PULL_UP != 0 {
+		r |= GPIOLINE_FLAG_BIAS_PULL_UP
+	}
+	if f&GPIO_V2_LINE_FLAG_BIAS_PULL_DOWN != 0 {
+		r |= GPIOLINE_FLAG_BIAS_PULL_DOWN
+	}
+	if f&GPIO_V2_LINE_FLAG_BIAS_DISABLED != 0 {
+		r |= GPIOLINE_FLAG_BIAS_DISABLE
+	}
+	return r
+}
+
+// Converts to v1 LineInfo used by high-level API.
+func (li *LineInfoV2) LineInfo() LineInfo {
+	return LineInfo{
+		LineOffset: li.Offset,
+		Flags:      li.Flags.V1(),
+		Name:       li.Name,
+		Consumer:   li.Consumer,
+	}
+}
+
+// Mask for GetValues/SetValues with bit i set for each of `count` lines.
+func MaskAll(count uint32) uint64 {
+	if count >= 64 {
+		return ^uint64(0)
+	}
+	return (uint64(1) << count) - 1
+}
+
+// Packs values[i] into bit i for SetValues.
+// Anything else than 0 is interpreted as 1, same as v1 HandleData.
+func ValuesToBits(values []byte) uint64 {
+	var bits uint64
+	for i, v := range values {
+		if v != 0 {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits
+}
+
+// Unpacks bit i into values[i], reverse of ValuesToBits.
+func BitsToValues(bits uint64, values []byte) {
+	for i := range values {
+		values[i] = byte((bits >> uint(i)) & 1)
+	}
+}
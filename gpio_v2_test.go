@@ -0,0 +1,97 @@
+package gpio
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestFlagV2(t *testing.T) {
+	assert.Equal(t, GPIO_V2_LINE_FLAG_INPUT|GPIO_V2_LINE_FLAG_ACTIVE_LOW,
+		(GPIOHANDLE_REQUEST_INPUT | GPIOHANDLE_REQUEST_ACTIVE_LOW).V2())
+	assert.Equal(t, GPIO_V2_LINE_FLAG_OUTPUT|GPIO_V2_LINE_FLAG_OPEN_DRAIN,
+		(GPIOHANDLE_REQUEST_OUTPUT | GPIOHANDLE_REQUEST_OPEN_DRAIN).V2())
+	assert.Equal(t, GPIO_V2_LINE_FLAG_EDGE_RISING|GPIO_V2_LINE_FLAG_EDGE_FALLING,
+		GPIOEVENT_REQUEST_BOTH_EDGES.V2())
+	assert.Equal(t, GPIOLINE_FLAG_KERNEL|GPIOLINE_FLAG_IS_OUT|GPIOLINE_FLAG_OPEN_SOURCE,
+		(GPIO_V2_LINE_FLAG_USED | GPIO_V2_LINE_FLAG_OUTPUT | GPIO_V2_LINE_FLAG_OPEN_SOURCE | GPIO_V2_LINE_FLAG_EDGE_RISING).V1())
+	assert.Equal(t, GPIO_V2_LINE_FLAG_INPUT|GPIO_V2_LINE_FLAG_BIAS_PULL_UP,
+		(GPIOHANDLE_REQUEST_INPUT | GPIOHANDLE_REQUEST_BIAS_PULL_UP).V2())
+	assert.Equal(t, GPIOLINE_FLAG_BIAS_DISABLE, GPIO_V2_LINE_FLAG_BIAS_DISABLED.V1())
+}
+
+func TestRequestFlagCheck(t *testing.T) {
+	assert.NoError(t, (GPIOHANDLE_REQUEST_INPUT | GPIOHANDLE_REQUEST_BIAS_PULL_DOWN).Check())
+	assert.Error(t, (GPIOHANDLE_REQUEST_INPUT | GPIOHANDLE_REQUEST_OUTPUT).Check())
+	assert.Error(t, (GPIOHANDLE_REQUEST_INPUT | GPIOHANDLE_REQUEST_BIAS_PULL_UP | GPIOHANDLE_REQUEST_BIAS_DISABLE).Check())
+	assert.Error(t, GPIOHANDLE_REQUEST_BIAS_PULL_UP.Check())
+}
+
+func TestAnnotateRequest(t *testing.T) {
+	busy := os.NewSyscallError("SYS_IOCTL", syscall.EBUSY)
+	err := annotateRequest(busy, "GPIO_V2_GET_LINE", GPIOHANDLE_REQUEST_OUTPUT, []uint32{17, 27})
+	assert.Equal(t, "GPIO_V2_GET_LINE lines=[17 27] flags=2: SYS_IOCTL: device or resource busy", err.Error())
+	assert.True(t, isErrno(err, syscall.EBUSY))
+	inval := os.NewSyscallError("SYS_IOCTL", syscall.EINVAL)
+	err = annotateRequest(inval, "GET_LINEHANDLE", GPIOHANDLE_REQUEST_INPUT|GPIOHANDLE_REQUEST_BIAS_PULL_UP, []uint32{4})
+	assert.Contains(t, err.Error(), "lines=[4] flags=21 kernel rejected BIAS flags")
+}
+
+func TestValuesBits(t *testing.T) {
+	assert.Equal(t, uint64(0x7), MaskAll(3))
+	assert.Equal(t, ^uint64(0), MaskAll(64))
+	assert.Equal(t, uint64(0x5), ValuesToBits([]byte{1, 0, 7}))
+	vs := make([]byte, 4)
+	BitsToValues(0xa, vs)
+	assert.Equal(t, []byte{0, 1, 0, 1}, vs)
+}
+
+func TestLineAttributeDebounce(t *testing.T) {
+	var a LineAttribute
+	a.SetDebouncePeriodUs(5000)
+	assert.Equal(t, GPIO_V2_LINE_ATTR_ID_DEBOUNCE, a.ID)
+	assert.Equal(t, uint32(5000), a.DebouncePeriodUs())
+}
+
+func TestCheckDebounce(t *testing.T) {
+	assert.NoError(t, checkDebounce(0))
+	assert.NoError(t, checkDebounce(5*time.Millisecond))
+	assert.Error(t, checkDebounce(-time.Millisecond))
+	assert.Error(t, checkDebounce(time.Nanosecond))
+	assert.Error(t, checkDebounce(2*time.Hour))
+}
+
+func TestEventBufferSizeV2(t *testing.T) {
+	assert.Equal(t, uint32(16), EventBufferSizeV2(0, 1))
+	assert.Equal(t, uint32(64), EventBufferSizeV2(0, 3))
+	assert.Equal(t, uint32(128), EventBufferSizeV2(100, 1))
+	assert.Equal(t, uint32(1024), EventBufferSizeV2(5000, 1))
+}
+
+func TestEventDropped(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer w.Close()
+	le := &lineEvent{chip: &chip{fa: newFdArc(-1)}, f: r, v2: true}
+	le.chip.fa.incref()
+	defer le.Close()
+
+	write := func(seqno uint32) {
+		e := LineEvent{ID: GPIO_V2_LINE_EVENT_RISING_EDGE, Seqno: seqno, LineSeqno: seqno}
+		b := (*[unsafe.Sizeof(LineEvent{})]byte)(unsafe.Pointer(&e))
+		_, err := w.Write(b[:])
+		require.NoError(t, err)
+	}
+	for _, seqno := range []uint32{1, 2, 5, 6} {
+		write(seqno)
+		e, err := le.Wait(time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, seqno, e.Seqno)
+	}
+	assert.Equal(t, uint64(2), le.Dropped())
+}
@@ -0,0 +1,461 @@
+// HTTP/JSON interface to GPIO chips.
+// Server owns all line requests, so clients never touch /dev/gpiochip.
+//
+// Endpoints, CHIP is kernel name like "gpiochip0", LINE is offset:
+//
+//	GET    /chips                              list chips
+//	GET    /chips/CHIP/lines                   state of all lines, see gpio.LineState
+//	GET    /chips/CHIP/lines/LINE              state of one line
+//	GET    /chips/CHIP/lines/LINE/value        {"value":0|1}
+//	PUT    /chips/CHIP/lines/LINE/value        {"value":0|1} request line as output and hold it
+//	DELETE /chips/CHIP/lines/LINE              release held output
+//	GET    /chips/CHIP/lines/LINE/events       Server-Sent Events stream, ?edge=rising|falling|both
+//
+// Event streams of one line share single line request, so any number of
+// clients may subscribe, and GET value reads through it. Line streaming events
+// can't be written until all its streams end.
+// Errors are {"error":"message"} with appropriate HTTP status.
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+type Server struct {
+	consumer string
+	chips    map[string]gpio.Chiper
+	order    []string
+
+	mu      sync.Mutex
+	outputs map[lineKey]gpio.Lineser
+	inputs  map[lineKey]*eventHub
+}
+
+// One event request per line, fanned out to all streams of that line.
+type eventHub struct {
+	ev   gpio.Eventer
+	mu   sync.Mutex
+	subs map[chan gpio.Event]struct{}
+	// why subscriber channels were closed, nil when hub was released
+	err error
+}
+
+// Events for slow client are dropped when its buffer is full,
+// so it never delays other clients.
+const subscriberBuffer = 64
+
+type lineKey struct {
+	chip string
+	line uint32
+}
+
+type ChipJSON struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Lines uint32 `json:"lines"`
+}
+
+type ValueJSON struct {
+	Value byte `json:"value"`
+}
+
+type EventJSON struct {
+	Line      uint32    `json:"line"`
+	Edge      string    `json:"edge"`
+	Timestamp uint64    `json:"timestamp_ns"`
+	Time      time.Time `json:"time"`
+	Seqno     uint32    `json:"seqno"`
+}
+
+// `consumer` labels all lines requested by server.
+// Chips are addressed by kernel name from ChipInfo.
+// Server doesn't close chips, but Close releases held outputs.
+func NewServer(consumer string, chips ...gpio.Chiper) *Server {
+	s := &Server{
+		consumer: consumer,
+		chips:    make(map[string]gpio.Chiper, len(chips)),
+		outputs:  make(map[lineKey]gpio.Lineser),
+		inputs:   make(map[lineKey]*eventHub),
+	}
+	for _, c := range chips {
+		info := c.Info()
+		name := (&gpio.ChipEntry{Info: info}).Name()
+		s.chips[name] = c
+		s.order = append(s.order, name)
+	}
+	return s
+}
+
+// Releases all held output lines and ends event streams.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for k, l := range s.outputs {
+		if err := l.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.outputs, k)
+	}
+	for k, h := range s.inputs {
+		if err := h.ev.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.inputs, k)
+	}
+	return firstErr
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// chips / CHIP / lines / LINE / value|events
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 0 || parts[0] != "chips" {
+		writeError(w, http.StatusNotFound, errors.NotFoundf("path=%s", r.URL.Path))
+		return
+	}
+	if len(parts) == 1 {
+		s.listChips(w, r)
+		return
+	}
+	chip, ok := s.chips[parts[1]]
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.NotFoundf("chip=%s", parts[1]))
+		return
+	}
+	if len(parts) == 2 || parts[2] != "lines" {
+		writeError(w, http.StatusNotFound, errors.NotFoundf("path=%s", r.URL.Path))
+		return
+	}
+	if len(parts) == 3 {
+		s.listLines(w, r, chip)
+		return
+	}
+	n, err := strconv.ParseUint(parts[3], 10, 32)
+	if err != nil || uint32(n) >= chip.Info().Lines {
+		writeError(w, http.StatusNotFound, errors.NotFoundf("line=%s", parts[3]))
+		return
+	}
+	key := lineKey{chip: parts[1], line: uint32(n)}
+	switch {
+	case len(parts) == 4:
+		s.line(w, r, chip, key)
+	case len(parts) == 5 && parts[4] == "value":
+		s.value(w, r, chip, key)
+	case len(parts) == 5 && parts[4] == "events":
+		s.events(w, r, chip, key)
+	default:
+		writeError(w, http.StatusNotFound, errors.NotFoundf("path=%s", r.URL.Path))
+	}
+}
+
+func (s *Server) listChips(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	result := make([]ChipJSON, 0, len(s.order))
+	for _, name := range s.order {
+		e := gpio.ChipEntry{Info: s.chips[name].Info()}
+		result = append(result, ChipJSON{Name: name, Label: e.Label(), Lines: e.Info.Lines})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) listLines(w http.ResponseWriter, r *http.Request, chip gpio.Chiper) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	states, err := chip.Snapshot()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+func (s *Server) line(w http.ResponseWriter, r *http.Request, chip gpio.Chiper, key lineKey) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	if r.Method == http.MethodDelete {
+		s.mu.Lock()
+		l, ok := s.outputs[key]
+		delete(s.outputs, key)
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.NotFoundf("held output line=%d", key.line))
+			return
+		}
+		if err := l.Close(); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	li, err := chip.LineInfo(key.line)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, li.State())
+}
+
+func (s *Server) value(w http.ResponseWriter, r *http.Request, chip gpio.Chiper, key lineKey) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held := s.outputs[key]
+	hub := s.inputs[key]
+
+	if r.Method == http.MethodGet && hub != nil {
+		v, err := hub.ev.Read()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ValueJSON{Value: v})
+		return
+	}
+	if r.Method == http.MethodGet {
+		lines := held
+		if lines == nil {
+			var err error
+			if lines, err = chip.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT, s.consumer, key.line); err != nil {
+				writeError(w, statusOf(err), err)
+				return
+			}
+			defer lines.Close()
+		}
+		data, err := lines.Read()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ValueJSON{Value: data.Values[0]})
+		return
+	}
+
+	var v ValueJSON
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil || v.Value > 1 {
+		writeError(w, http.StatusBadRequest, errors.NotValidf("body, expected {\"value\":0|1}"))
+		return
+	}
+	if hub != nil {
+		err := errors.AlreadyExistsf("line=%d event stream", key.line)
+		writeError(w, statusOf(err), err)
+		return
+	}
+	if held == nil {
+		lines, err := chip.OpenLinesWith(gpio.GPIOHANDLE_REQUEST_OUTPUT, s.consumer,
+			gpio.LineOptions{DefaultValues: []byte{v.Value}}, key.line)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		s.outputs[key] = lines
+		writeJSON(w, http.StatusOK, v)
+		return
+	}
+	held.SetBulk(v.Value)
+	if err := held.Flush(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) events(w http.ResponseWriter, r *http.Request, chip gpio.Chiper, key lineKey) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.NotSupportedf("streaming"))
+		return
+	}
+	var events gpio.EventFlag
+	switch r.URL.Query().Get("edge") {
+	case "rising":
+		events = gpio.GPIOEVENT_REQUEST_RISING_EDGE
+	case "falling":
+		events = gpio.GPIOEVENT_REQUEST_FALLING_EDGE
+	case "", "both":
+		events = gpio.GPIOEVENT_REQUEST_BOTH_EDGES
+	default:
+		writeError(w, http.StatusBadRequest, errors.NotValidf("edge=%s", r.URL.Query().Get("edge")))
+		return
+	}
+	hub, ch, err := s.subscribe(chip, key)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	defer s.unsubscribe(key, hub, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	done := r.Context().Done()
+	for {
+		var e gpio.Event
+		select {
+		case <-done:
+			return
+		case e, ok = <-ch:
+		}
+		if !ok {
+			hub.mu.Lock()
+			err = hub.err
+			hub.mu.Unlock()
+			if err != nil {
+				fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+				flusher.Flush()
+			}
+			return
+		}
+		// event ID values match request flag bits
+		if events&gpio.EventFlag(e.ID) == 0 {
+			continue
+		}
+		edge := "falling"
+		if e.ID == gpio.GPIOEVENT_EVENT_RISING_EDGE {
+			edge = "rising"
+		}
+		b, _ := json.Marshal(EventJSON{
+			Line:      key.line,
+			Edge:      edge,
+			Timestamp: e.Timestamp,
+			Time:      e.Time(),
+			Seqno:     e.Seqno,
+		})
+		fmt.Fprintf(w, "event: edge\ndata: %s\n\n", b)
+		flusher.Flush()
+	}
+}
+
+// Requests line for events on first subscriber, both edges, streams filter.
+func (s *Server) subscribe(chip gpio.Chiper, key lineKey) (*eventHub, chan gpio.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.outputs[key]; ok {
+		return nil, nil, errors.AlreadyExistsf("line=%d held as output", key.line)
+	}
+	hub := s.inputs[key]
+	if hub == nil {
+		ev, err := chip.GetLineEvent(key.line, 0, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, s.consumer)
+		if err != nil {
+			return nil, nil, err
+		}
+		hub = &eventHub{ev: ev, subs: make(map[chan gpio.Event]struct{})}
+		s.inputs[key] = hub
+		go s.dispatch(key, hub)
+	}
+	ch := make(chan gpio.Event, subscriberBuffer)
+	hub.mu.Lock()
+	hub.subs[ch] = struct{}{}
+	hub.mu.Unlock()
+	return hub, ch, nil
+}
+
+// Releases line after last subscriber.
+func (s *Server) unsubscribe(key lineKey, hub *eventHub, ch chan gpio.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hub.mu.Lock()
+	delete(hub.subs, ch)
+	last := len(hub.subs) == 0
+	hub.mu.Unlock()
+	if last && s.inputs[key] == hub {
+		delete(s.inputs, key)
+		_ = hub.ev.Close()
+	}
+}
+
+// Blocking Wait ends with ErrClosed when hub is released.
+func (s *Server) dispatch(key lineKey, hub *eventHub) {
+	for {
+		e, err := hub.ev.Wait(0)
+		if gpio.IsTimeout(err) {
+			continue
+		}
+		if err != nil {
+			s.mu.Lock()
+			released := s.inputs[key] != hub
+			if !released {
+				delete(s.inputs, key)
+				_ = hub.ev.Close()
+			}
+			s.mu.Unlock()
+			hub.mu.Lock()
+			if !released {
+				hub.err = err
+			}
+			for ch := range hub.subs {
+				close(ch)
+			}
+			hub.subs = nil
+			hub.mu.Unlock()
+			return
+		}
+		hub.mu.Lock()
+		for ch := range hub.subs {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+		hub.mu.Unlock()
+	}
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.NotSupportedf("method=%s", r.Method))
+	return false
+}
+
+// Line already requested by someone else or held by server in other mode is conflict,
+// invalid arguments are bad request.
+func statusOf(err error) int {
+	switch {
+	case errors.IsNotValid(err):
+		return http.StatusBadRequest
+	case errors.IsNotSupported(err):
+		return http.StatusNotImplemented
+	case errors.IsAlreadyExists(err):
+		return http.StatusConflict
+	}
+	if se, ok := errors.Cause(err).(*os.SyscallError); ok && se.Err == syscall.EBUSY {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
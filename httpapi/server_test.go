@@ -0,0 +1,188 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/temoto/gpio-cdev-go"
+	gpio_mock "github.com/temoto/gpio-cdev-go/mock"
+)
+
+func testServer(t *testing.T) (*gpio_mock.MockChip, *httptest.Server) {
+	var info gpio.ChipInfo
+	copy(info.Name[:], "gpiochip0")
+	copy(info.Label[:], "pinctrl-test")
+	info.Lines = 4
+	chip := &gpio_mock.MockChip{}
+	chip.On("Info").Return(info)
+	s := NewServer("test", chip)
+	return chip, httptest.NewServer(s)
+}
+
+func do(t *testing.T, method, url, body string, v interface{}) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp
+}
+
+func TestListChips(t *testing.T) {
+	_, ts := testServer(t)
+	defer ts.Close()
+	var chips []ChipJSON
+	resp := do(t, "GET", ts.URL+"/chips", "", &chips)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []ChipJSON{{Name: "gpiochip0", Label: "pinctrl-test", Lines: 4}}, chips)
+
+	resp = do(t, "GET", ts.URL+"/chips/gpiochip9/lines", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = do(t, "GET", ts.URL+"/chips/gpiochip0/lines/4", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = do(t, "POST", ts.URL+"/chips", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestListLines(t *testing.T) {
+	chip, ts := testServer(t)
+	defer ts.Close()
+	states := []gpio.LineState{{Offset: 0, Name: "LED", Direction: "output"}}
+	chip.On("Snapshot").Return(states, nil)
+	var got []gpio.LineState
+	resp := do(t, "GET", ts.URL+"/chips/gpiochip0/lines", "", &got)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, states, got)
+}
+
+func TestReadValue(t *testing.T) {
+	chip, ts := testServer(t)
+	defer ts.Close()
+	lines := &gpio_mock.MockLines{}
+	lines.On("Read").Return(gpio.HandleData{Values: [gpio.GPIOHANDLES_MAX]byte{1}}, nil)
+	lines.On("Close").Return(nil)
+	chip.On("OpenLines", gpio.GPIOHANDLE_REQUEST_INPUT, "test", uint32(2)).Return(lines, nil)
+
+	var v ValueJSON
+	resp := do(t, "GET", ts.URL+"/chips/gpiochip0/lines/2/value", "", &v)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, byte(1), v.Value)
+	// input is released right after read
+	lines.AssertCalled(t, "Close")
+}
+
+func TestWriteValue(t *testing.T) {
+	chip, ts := testServer(t)
+	defer ts.Close()
+	lines := &gpio_mock.MockLines{}
+	chip.On("OpenLinesWith", gpio.GPIOHANDLE_REQUEST_OUTPUT, "test",
+		gpio.LineOptions{DefaultValues: []byte{1}}, uint32(3)).Return(lines, nil).Once()
+
+	var v ValueJSON
+	resp := do(t, "PUT", ts.URL+"/chips/gpiochip0/lines/3/value", `{"value":1}`, &v)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, byte(1), v.Value)
+
+	// held output is reused
+	lines.On("SetBulk", byte(0)).Return()
+	lines.On("Flush").Return(nil)
+	resp = do(t, "PUT", ts.URL+"/chips/gpiochip0/lines/3/value", `{"value":0}`, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	lines.On("Read").Return(gpio.HandleData{}, nil)
+	resp = do(t, "GET", ts.URL+"/chips/gpiochip0/lines/3/value", "", &v)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, byte(0), v.Value)
+
+	resp = do(t, "PUT", ts.URL+"/chips/gpiochip0/lines/3/value", `{"value":2}`, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	lines.On("Close").Return(nil)
+	resp = do(t, "DELETE", ts.URL+"/chips/gpiochip0/lines/3", "", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do(t, "DELETE", ts.URL+"/chips/gpiochip0/lines/3", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	chip.AssertExpectations(t)
+	lines.AssertExpectations(t)
+}
+
+func readEvent(t *testing.T, r *bufio.Reader) EventJSON {
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: edge\n", line)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	var e EventJSON
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+	_, err = r.ReadString('\n')
+	require.NoError(t, err)
+	return e
+}
+
+func TestEvents(t *testing.T) {
+	chip, ts := testServer(t)
+	defer ts.Close()
+	ev := &gpio_mock.MockEvent{}
+	ready, closed := make(chan struct{}), make(chan struct{})
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{EventData: gpio.EventData{Timestamp: 41, ID: gpio.GPIOEVENT_EVENT_FALLING_EDGE}, Seqno: 1}, nil).
+		Run(func(mock.Arguments) { <-ready }).Once()
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{EventData: gpio.EventData{Timestamp: 42, ID: gpio.GPIOEVENT_EVENT_RISING_EDGE}, Seqno: 2}, nil).Once()
+	// real Eventer ends blocked Wait on Close
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{}, gpio.ErrClosed).Run(func(mock.Arguments) { <-closed })
+	ev.On("Read").Return(byte(1), nil)
+	ev.On("Close").Return(nil).Run(func(mock.Arguments) { close(closed) }).Once()
+	// one request for all streams of line
+	chip.On("GetLineEvent", uint32(1), gpio.RequestFlag(0), gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "test").Return(ev, nil).Once()
+
+	rising, err := http.Get(ts.URL + "/chips/gpiochip0/lines/1/events?edge=rising")
+	require.NoError(t, err)
+	defer rising.Body.Close()
+	assert.Equal(t, "text/event-stream", rising.Header.Get("Content-Type"))
+	both, err := http.Get(ts.URL + "/chips/gpiochip0/lines/1/events")
+	require.NoError(t, err)
+	defer both.Body.Close()
+
+	// value is read through held event request, line is busy for writes
+	var v ValueJSON
+	resp := do(t, "GET", ts.URL+"/chips/gpiochip0/lines/1/value", "", &v)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, byte(1), v.Value)
+	resp = do(t, "PUT", ts.URL+"/chips/gpiochip0/lines/1/value", `{"value":1}`, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	close(ready)
+
+	rb := bufio.NewReader(both.Body)
+	e := readEvent(t, rb)
+	assert.Equal(t, "falling", e.Edge)
+	e = readEvent(t, rb)
+	assert.Equal(t, "rising", e.Edge)
+	e = readEvent(t, bufio.NewReader(rising.Body))
+	assert.Equal(t, uint32(1), e.Line)
+	assert.Equal(t, "rising", e.Edge, "falling filtered out")
+	assert.Equal(t, uint64(42), e.Timestamp)
+
+	rising.Body.Close()
+	select {
+	case <-closed:
+		t.Fatal("line released while other stream is open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// last disconnect releases event request
+	both.Body.Close()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event request not closed after client disconnect")
+	}
+	chip.AssertExpectations(t)
+}
@@ -20,6 +20,15 @@ func TestIoctlHelper(t *testing.T) {
 		{"GPIO_GET_LINEEVENT_IOCTL", GPIO_GET_LINEEVENT_IOCTL, ioWR(0xb4, 0x04, unsafe.Sizeof(EventRequest{}))},
 		{"GPIOHANDLE_GET_LINE_VALUES_IOCTL", GPIOHANDLE_GET_LINE_VALUES_IOCTL, ioWR(0xb4, 0x08, unsafe.Sizeof(HandleData{}))},
 		{"GPIOHANDLE_SET_LINE_VALUES_IOCTL", GPIOHANDLE_SET_LINE_VALUES_IOCTL, ioWR(0xb4, 0x09, unsafe.Sizeof(HandleData{}))},
+		{"GPIOHANDLE_SET_CONFIG_IOCTL", GPIOHANDLE_SET_CONFIG_IOCTL, ioWR(0xb4, 0x0a, unsafe.Sizeof(HandleConfig{}))},
+		{"GPIO_GET_LINEINFO_WATCH_IOCTL", GPIO_GET_LINEINFO_WATCH_IOCTL, ioWR(0xb4, 0x0b, unsafe.Sizeof(LineInfo{}))},
+		{"GPIO_GET_LINEINFO_UNWATCH_IOCTL", GPIO_GET_LINEINFO_UNWATCH_IOCTL, ioWR(0xb4, 0x0c, unsafe.Sizeof(uint32(0)))},
+		{"GPIO_V2_GET_LINEINFO_WATCH_IOCTL", GPIO_V2_GET_LINEINFO_WATCH_IOCTL, ioWR(0xb4, 0x06, unsafe.Sizeof(LineInfoV2{}))},
+		{"GPIO_V2_GET_LINEINFO_IOCTL", GPIO_V2_GET_LINEINFO_IOCTL, ioWR(0xb4, 0x05, unsafe.Sizeof(LineInfoV2{}))},
+		{"GPIO_V2_GET_LINE_IOCTL", GPIO_V2_GET_LINE_IOCTL, ioWR(0xb4, 0x07, unsafe.Sizeof(LineRequest{}))},
+		{"GPIO_V2_LINE_SET_CONFIG_IOCTL", GPIO_V2_LINE_SET_CONFIG_IOCTL, ioWR(0xb4, 0x0d, unsafe.Sizeof(LineConfig{}))},
+		{"GPIO_V2_LINE_GET_VALUES_IOCTL", GPIO_V2_LINE_GET_VALUES_IOCTL, ioWR(0xb4, 0x0e, unsafe.Sizeof(LineValues{}))},
+		{"GPIO_V2_LINE_SET_VALUES_IOCTL", GPIO_V2_LINE_SET_VALUES_IOCTL, ioWR(0xb4, 0x0f, unsafe.Sizeof(LineValues{}))},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -27,3 +36,16 @@ func TestIoctlHelper(t *testing.T) {
 		})
 	}
 }
+
+// sizes from pahole on arm and amd64
+func TestStructSize(t *testing.T) {
+	assert.Equal(t, uintptr(16), unsafe.Sizeof(EventData{}))
+	assert.Equal(t, uintptr(104), unsafe.Sizeof(LineInfoChanged{}))
+	assert.Equal(t, uintptr(16), unsafe.Sizeof(LineAttribute{}))
+	assert.Equal(t, uintptr(24), unsafe.Sizeof(LineConfigAttribute{}))
+	assert.Equal(t, uintptr(272), unsafe.Sizeof(LineConfig{}))
+	assert.Equal(t, uintptr(592), unsafe.Sizeof(LineRequest{}))
+	assert.Equal(t, uintptr(256), unsafe.Sizeof(LineInfoV2{}))
+	assert.Equal(t, uintptr(288), unsafe.Sizeof(LineInfoChangedV2{}))
+	assert.Equal(t, uintptr(48), unsafe.Sizeof(LineEvent{}))
+}
@@ -20,6 +20,11 @@ func (m *MockChip) LineInfo(line uint32) (gpio.LineInfo, error) {
 	return returns.Get(0).(gpio.LineInfo), returns.Error(1)
 }
 
+func (m *MockChip) Snapshot() ([]gpio.LineState, error) {
+	returns := m.Called()
+	return returns.Get(0).([]gpio.LineState), returns.Error(1)
+}
+
 func (m *MockChip) OpenLines(flag gpio.RequestFlag, consumerLabel string, lines ...uint32) (gpio.Lineser, error) {
 	args := []interface{}{flag, consumerLabel}
 	for _, x := range lines {
@@ -29,17 +34,70 @@ func (m *MockChip) OpenLines(flag gpio.RequestFlag, consumerLabel string, lines
 	return returns.Get(0).(gpio.Lineser), returns.Error(1)
 }
 
+func (m *MockChip) OpenLinesWith(flag gpio.RequestFlag, consumerLabel string, opt gpio.LineOptions, lines ...uint32) (gpio.Lineser, error) {
+	args := []interface{}{flag, consumerLabel, opt}
+	for _, x := range lines {
+		args = append(args, x)
+	}
+	returns := m.Called(args...)
+	return returns.Get(0).(gpio.Lineser), returns.Error(1)
+}
+
+func (m *MockChip) OpenLinesByName(flag gpio.RequestFlag, consumerLabel string, names ...string) (gpio.Lineser, error) {
+	args := []interface{}{flag, consumerLabel}
+	for _, x := range names {
+		args = append(args, x)
+	}
+	returns := m.Called(args...)
+	return returns.Get(0).(gpio.Lineser), returns.Error(1)
+}
+
+func (m *MockChip) FindLines(names ...string) ([]uint32, error) {
+	args := make([]interface{}, len(names))
+	for i, x := range names {
+		args[i] = x
+	}
+	returns := m.Called(args...)
+	return returns.Get(0).([]uint32), returns.Error(1)
+}
+
 func (m *MockChip) GetLineEvent(line uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string) (gpio.Eventer, error) {
 	returns := m.Called(line, flag, events, consumerLabel)
 	return returns.Get(0).(gpio.Eventer), returns.Error(1)
 }
 
+func (m *MockChip) GetLineEventWith(line uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string, opt gpio.EventOptions) (gpio.Eventer, error) {
+	returns := m.Called(line, flag, events, consumerLabel, opt)
+	return returns.Get(0).(gpio.Eventer), returns.Error(1)
+}
+
+func (m *MockChip) GetLinesEvent(lines []uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string, opt gpio.EventOptions) (gpio.Eventer, error) {
+	returns := m.Called(lines, flag, events, consumerLabel, opt)
+	return returns.Get(0).(gpio.Eventer), returns.Error(1)
+}
+
+func (m *MockChip) WatchLineInfo(lines ...uint32) (gpio.LineWatcher, error) {
+	args := make([]interface{}, len(lines))
+	for i, x := range lines {
+		args[i] = x
+	}
+	returns := m.Called(args...)
+	return returns.Get(0).(gpio.LineWatcher), returns.Error(1)
+}
+
 type MockLines struct{ mock.Mock }
 
 func (m *MockLines) Close() error { return m.Called().Error(0) }
 
 func (m *MockLines) Flush() error { return m.Called().Error(0) }
 
+func (m *MockLines) GetValues(mask uint64) (uint64, error) {
+	returns := m.Called(mask)
+	return returns.Get(0).(uint64), returns.Error(1)
+}
+
+func (m *MockLines) SetValues(mask, bits uint64) error { return m.Called(mask, bits).Error(0) }
+
 func (m *MockLines) LineOffsets() []uint32 { return m.Called().Get(0).([]uint32) }
 
 func (m *MockLines) Read() (gpio.HandleData, error) {
@@ -55,6 +113,14 @@ func (m *MockLines) SetBulk(bs ...byte) {
 	m.Called(args...)
 }
 
+func (m *MockLines) SetConfig(flag gpio.RequestFlag, defaultValues ...byte) error {
+	args := []interface{}{flag}
+	for _, x := range defaultValues {
+		args = append(args, x)
+	}
+	return m.Called(args...).Error(0)
+}
+
 func (m *MockLines) SetFunc(line uint32) gpio.LineSetFunc {
 	return m.Called(line).Get(0).(gpio.LineSetFunc)
 }
@@ -63,15 +129,38 @@ type MockEvent struct{ mock.Mock }
 
 func (m *MockEvent) Close() error { return m.Called().Error(0) }
 
+func (m *MockEvent) BufferSize() uint32 { return m.Called().Get(0).(uint32) }
+
+func (m *MockEvent) Dropped() uint64 { return m.Called().Get(0).(uint64) }
+
 func (m *MockEvent) Read() (byte, error) {
 	returns := m.Called()
 	return returns.Get(0).(byte), returns.Error(1)
 }
 
-func (m *MockEvent) Wait(timeout time.Duration) (gpio.EventData, error) {
+func (m *MockEvent) Wait(timeout time.Duration) (gpio.Event, error) {
+	returns := m.Called(timeout)
+	return returns.Get(0).(gpio.Event), returns.Error(1)
+}
+
+type MockWatcher struct{ mock.Mock }
+
+func (m *MockWatcher) Close() error { return m.Called().Error(0) }
+
+func (m *MockWatcher) Watch(line uint32) (gpio.LineInfo, error) {
+	returns := m.Called(line)
+	return returns.Get(0).(gpio.LineInfo), returns.Error(1)
+}
+
+func (m *MockWatcher) Unwatch(line uint32) error { return m.Called(line).Error(0) }
+
+func (m *MockWatcher) Wait(timeout time.Duration) (gpio.LineInfoChanged, error) {
 	returns := m.Called(timeout)
-	return returns.Get(0).(gpio.EventData), returns.Error(1)
+	return returns.Get(0).(gpio.LineInfoChanged), returns.Error(1)
 }
 
 // compile-time interface check
 var _ gpio.Chiper = &MockChip{}
+var _ gpio.Lineser = &MockLines{}
+var _ gpio.Eventer = &MockEvent{}
+var _ gpio.LineWatcher = &MockWatcher{}
@@ -0,0 +1,405 @@
+// Modbus TCP server exposing GPIO lines to PLC/SCADA.
+// Outputs are coils, inputs are discrete inputs, and count of edges on
+// input since server start is 32 bit value in two input registers,
+// high word first. Addresses are configured explicitly, reading or
+// writing unmapped address returns "illegal data address" exception.
+// After event read error on input, its counter registers return
+// "device failure" exception instead of stale count.
+//
+// Supported functions: 1 read coils, 2 read discrete inputs,
+// 4 read input registers, 5 write single coil, 15 write multiple coils.
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+const (
+	FuncReadCoils          = 0x01
+	FuncReadDiscreteInputs = 0x02
+	FuncReadInputRegisters = 0x04
+	FuncWriteSingleCoil    = 0x05
+	FuncWriteMultipleCoils = 0x0f
+)
+
+const (
+	ExceptionIllegalFunction    = 0x01
+	ExceptionIllegalDataAddress = 0x02
+	ExceptionIllegalDataValue   = 0x03
+	ExceptionDeviceFailure      = 0x04
+)
+
+// Output line mapped to coil.
+type Coil struct {
+	Address uint16
+	Line    uint32
+	// drive like GPIOHANDLE_REQUEST_OPEN_DRAIN, GPIOHANDLE_REQUEST_ACTIVE_LOW inverts coil
+	Flag gpio.RequestFlag
+	// value set when server opens line
+	Initial byte
+}
+
+// Input line mapped to discrete input and optional edge counter.
+type Input struct {
+	Address uint16
+	Line    uint32
+	// bias for event request, GPIOHANDLE_REQUEST_ACTIVE_LOW inverts discrete input
+	Flag gpio.RequestFlag
+	// see gpio.EventOptions.Debounce
+	Debounce time.Duration
+
+	// edge count in input registers CounterAddress (high) and CounterAddress+1 (low)
+	Counter        bool
+	CounterAddress uint16
+}
+
+type Config struct {
+	Coils  []Coil
+	Inputs []Input
+
+	// requests to other unit ids are ignored, 0 accepts any
+	UnitID byte
+
+	// LineInfo consumer of coils and inputs, empty uses chip default
+	Consumer string
+}
+
+type Server struct {
+	coils     map[uint16]*coil
+	inputs    map[uint16]*input
+	registers map[uint16]register
+	unitID    byte
+
+	closed uint32
+	wg     sync.WaitGroup
+}
+
+type coil struct {
+	lines gpio.Lineser
+	mu    sync.Mutex
+	value byte
+}
+
+type input struct {
+	event  gpio.Eventer
+	edges  uint32
+	failed uint32 // counting stopped on error, registers are not valid
+}
+
+// half of 32 bit edge counter
+type register struct {
+	input *input
+	high  bool
+}
+
+// Requests all lines and starts counting edges, they are held until Close.
+func New(chip gpio.Chiper, cfg Config) (*Server, error) {
+	const tag = "modbus.New"
+	s := &Server{
+		coils:     make(map[uint16]*coil, len(cfg.Coils)),
+		inputs:    make(map[uint16]*input, len(cfg.Inputs)),
+		registers: make(map[uint16]register),
+		unitID:    cfg.UnitID,
+	}
+	for _, c := range cfg.Coils {
+		if _, ok := s.coils[c.Address]; ok {
+			s.Close()
+			return nil, errors.NotValidf("%s duplicate coil address=%d", tag, c.Address)
+		}
+		lines, err := chip.OpenLinesWith(gpio.GPIOHANDLE_REQUEST_OUTPUT|c.Flag, cfg.Consumer,
+			gpio.LineOptions{DefaultValues: []byte{c.Initial}}, c.Line)
+		if err != nil {
+			s.Close()
+			return nil, errors.Annotatef(err, "%s coil line=%d", tag, c.Line)
+		}
+		s.coils[c.Address] = &coil{lines: lines, value: c.Initial}
+	}
+	for _, in := range cfg.Inputs {
+		if _, ok := s.inputs[in.Address]; ok {
+			s.Close()
+			return nil, errors.NotValidf("%s duplicate discrete input address=%d", tag, in.Address)
+		}
+		if in.Counter {
+			_, hi := s.registers[in.CounterAddress]
+			_, lo := s.registers[in.CounterAddress+1]
+			if hi || lo || in.CounterAddress == 0xffff {
+				s.Close()
+				return nil, errors.NotValidf("%s counter address=%d", tag, in.CounterAddress)
+			}
+		}
+		event, err := chip.GetLineEventWith(in.Line, in.Flag, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, cfg.Consumer,
+			gpio.EventOptions{Debounce: in.Debounce})
+		if err != nil {
+			s.Close()
+			return nil, errors.Annotatef(err, "%s input line=%d", tag, in.Line)
+		}
+		i := &input{event: event}
+		s.inputs[in.Address] = i
+		if in.Counter {
+			s.registers[in.CounterAddress] = register{input: i, high: true}
+			s.registers[in.CounterAddress+1] = register{input: i}
+		}
+		s.wg.Add(1)
+		go s.count(i)
+	}
+	return s, nil
+}
+
+// Stops counting and releases all lines. Close listener before.
+func (s *Server) Close() error {
+	if atomic.AddUint32(&s.closed, 1) != 1 {
+		return gpio.ErrClosed
+	}
+	var firstErr error
+	for _, c := range s.coils {
+		if err := c.lines.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	// ends blocked Wait in count
+	for _, i := range s.inputs {
+		if err := i.event.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.wg.Wait()
+	return firstErr
+}
+
+func (s *Server) count(i *input) {
+	defer s.wg.Done()
+	for {
+		if _, err := i.event.Wait(0); err != nil {
+			if !gpio.IsClosed(err) {
+				// missed edges make counter wrong, report instead of stale value
+				atomic.StoreUint32(&i.failed, 1)
+			}
+			return
+		}
+		atomic.AddUint32(&i.edges, 1)
+	}
+}
+
+// Accepts connections until listener fails, serving each in own goroutine.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return errors.Annotate(err, "modbus.Serve")
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// Serves requests of single connection until client disconnects or
+// sends malformed frame.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	var header [7]byte
+	for {
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		// transaction(2) protocol(2) length(2) unit(1)
+		length := binary.BigEndian.Uint16(header[4:6])
+		if binary.BigEndian.Uint16(header[2:4]) != 0 || length < 2 || length > 254 {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+		if s.unitID != 0 && header[6] != s.unitID {
+			continue
+		}
+		resp := s.handle(pdu)
+		out := make([]byte, 7, 7+len(resp))
+		copy(out, header[:4])
+		binary.BigEndian.PutUint16(out[4:6], uint16(len(resp)+1))
+		out[6] = header[6]
+		out = append(out, resp...)
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+// Returns response PDU.
+func (s *Server) handle(pdu []byte) []byte {
+	fun := pdu[0]
+	data := pdu[1:]
+	var resp []byte
+	var code byte
+	switch fun {
+	case FuncReadCoils, FuncReadDiscreteInputs:
+		resp, code = s.readBits(fun, data)
+	case FuncReadInputRegisters:
+		resp, code = s.readRegisters(data)
+	case FuncWriteSingleCoil:
+		resp, code = s.writeSingleCoil(data)
+	case FuncWriteMultipleCoils:
+		resp, code = s.writeMultipleCoils(data)
+	default:
+		code = ExceptionIllegalFunction
+	}
+	if code != 0 {
+		return []byte{fun | 0x80, code}
+	}
+	return append([]byte{fun}, resp...)
+}
+
+// start(2) quantity(2)
+func readRange(data []byte, limit uint16) (uint16, uint16, byte) {
+	if len(data) != 4 {
+		return 0, 0, ExceptionIllegalDataValue
+	}
+	start := binary.BigEndian.Uint16(data[0:2])
+	quantity := binary.BigEndian.Uint16(data[2:4])
+	if quantity == 0 || quantity > limit {
+		return 0, 0, ExceptionIllegalDataValue
+	}
+	if uint32(start)+uint32(quantity) > 0x10000 {
+		return 0, 0, ExceptionIllegalDataAddress
+	}
+	return start, quantity, 0
+}
+
+func (s *Server) readBits(fun byte, data []byte) ([]byte, byte) {
+	start, quantity, code := readRange(data, 2000)
+	if code != 0 {
+		return nil, code
+	}
+	values := make([]byte, quantity)
+	for i := range values {
+		addr := start + uint16(i)
+		if fun == FuncReadCoils {
+			c, ok := s.coils[addr]
+			if !ok {
+				return nil, ExceptionIllegalDataAddress
+			}
+			c.mu.Lock()
+			values[i] = c.value
+			c.mu.Unlock()
+			continue
+		}
+		in, ok := s.inputs[addr]
+		if !ok {
+			return nil, ExceptionIllegalDataAddress
+		}
+		v, err := in.event.Read()
+		if err != nil {
+			return nil, ExceptionDeviceFailure
+		}
+		values[i] = v
+	}
+	return packBits(values), 0
+}
+
+func (s *Server) readRegisters(data []byte) ([]byte, byte) {
+	start, quantity, code := readRange(data, 125)
+	if code != 0 {
+		return nil, code
+	}
+	resp := make([]byte, 1+2*int(quantity))
+	resp[0] = byte(2 * quantity)
+	for i := 0; i < int(quantity); i++ {
+		addr := start + uint16(i)
+		r, ok := s.registers[addr]
+		if !ok {
+			return nil, ExceptionIllegalDataAddress
+		}
+		if atomic.LoadUint32(&r.input.failed) != 0 {
+			return nil, ExceptionDeviceFailure
+		}
+		n := atomic.LoadUint32(&r.input.edges)
+		if r.high {
+			n >>= 16
+		}
+		binary.BigEndian.PutUint16(resp[1+2*i:], uint16(n))
+	}
+	return resp, 0
+}
+
+func (s *Server) writeSingleCoil(data []byte) ([]byte, byte) {
+	if len(data) != 4 {
+		return nil, ExceptionIllegalDataValue
+	}
+	addr := binary.BigEndian.Uint16(data[0:2])
+	var v byte
+	switch binary.BigEndian.Uint16(data[2:4]) {
+	case 0xff00:
+		v = 1
+	case 0x0000:
+	default:
+		return nil, ExceptionIllegalDataValue
+	}
+	c, ok := s.coils[addr]
+	if !ok {
+		return nil, ExceptionIllegalDataAddress
+	}
+	if err := c.set(v); err != nil {
+		return nil, ExceptionDeviceFailure
+	}
+	// echo of request
+	return data, 0
+}
+
+// start(2) quantity(2) bytes(1) values(bytes)
+func (s *Server) writeMultipleCoils(data []byte) ([]byte, byte) {
+	if len(data) < 5 {
+		return nil, ExceptionIllegalDataValue
+	}
+	start, quantity, code := readRange(data[:4], 0x7b0)
+	if code != 0 {
+		return nil, code
+	}
+	if int(data[4]) != (int(quantity)+7)/8 || len(data) != 5+int(data[4]) {
+		return nil, ExceptionIllegalDataValue
+	}
+	// check all before changing any
+	for i := uint16(0); i < quantity; i++ {
+		if _, ok := s.coils[start+i]; !ok {
+			return nil, ExceptionIllegalDataAddress
+		}
+	}
+	bits := data[5:]
+	for i := uint16(0); i < quantity; i++ {
+		v := (bits[i/8] >> (i % 8)) & 1
+		if err := s.coils[start+i].set(v); err != nil {
+			return nil, ExceptionDeviceFailure
+		}
+	}
+	return data[:4], 0
+}
+
+func (c *coil) set(v byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines.SetBulk(v)
+	if err := c.lines.Flush(); err != nil {
+		return err
+	}
+	c.value = v
+	return nil
+}
+
+// Returns byte count followed by bits, LSB first.
+func packBits(values []byte) []byte {
+	n := (len(values) + 7) / 8
+	b := make([]byte, 1+n)
+	b[0] = byte(n)
+	for i, v := range values {
+		if v != 0 {
+			b[1+i/8] |= 1 << uint(i%8)
+		}
+	}
+	return b
+}
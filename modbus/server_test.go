@@ -0,0 +1,151 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/temoto/gpio-cdev-go"
+	gpio_mock "github.com/temoto/gpio-cdev-go/mock"
+)
+
+// Minimal Modbus TCP client, returns response PDU.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	tx   uint16
+}
+
+func (c *testClient) call(pdu ...byte) []byte {
+	c.tx++
+	req := make([]byte, 7, 7+len(pdu))
+	binary.BigEndian.PutUint16(req[0:2], c.tx)
+	binary.BigEndian.PutUint16(req[4:6], uint16(len(pdu)+1))
+	req[6] = 1
+	req = append(req, pdu...)
+	_, err := c.conn.Write(req)
+	require.NoError(c.t, err)
+	var header [7]byte
+	_, err = io.ReadFull(c.conn, header[:])
+	require.NoError(c.t, err)
+	assert.Equal(c.t, c.tx, binary.BigEndian.Uint16(header[0:2]), "transaction id")
+	assert.Equal(c.t, byte(1), header[6], "unit id")
+	resp := make([]byte, binary.BigEndian.Uint16(header[4:6])-1)
+	_, err = io.ReadFull(c.conn, resp)
+	require.NoError(c.t, err)
+	return resp
+}
+
+func testLines() *gpio_mock.MockLines {
+	lines := &gpio_mock.MockLines{}
+	lines.On("SetBulk", mock.Anything).Return()
+	lines.On("Flush").Return(nil)
+	lines.On("Close").Return(nil)
+	return lines
+}
+
+func TestServer(t *testing.T) {
+	chip := &gpio_mock.MockChip{}
+	coil0, coil1 := testLines(), testLines()
+	chip.On("OpenLinesWith", gpio.GPIOHANDLE_REQUEST_OUTPUT, "", gpio.LineOptions{DefaultValues: []byte{1}}, uint32(5)).Return(coil0, nil)
+	chip.On("OpenLinesWith", gpio.GPIOHANDLE_REQUEST_OUTPUT|gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW, "", gpio.LineOptions{DefaultValues: []byte{0}}, uint32(6)).Return(coil1, nil)
+	ev := &gpio_mock.MockEvent{}
+	ev.On("Read").Return(byte(1), nil)
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{EventData: gpio.EventData{ID: gpio.GPIOEVENT_EVENT_RISING_EDGE}}, nil).Times(3)
+	// real Eventer ends blocked Wait on Close
+	closed := make(chan struct{})
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{}, gpio.ErrClosed).Run(func(mock.Arguments) { <-closed })
+	ev.On("Close").Return(nil).Run(func(mock.Arguments) { close(closed) })
+	chip.On("GetLineEventWith", uint32(1), gpio.RequestFlag(0), gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "", gpio.EventOptions{}).Return(ev, nil)
+
+	s, err := New(chip, Config{
+		Coils: []Coil{
+			{Address: 0, Line: 5, Initial: 1},
+			{Address: 1, Line: 6, Flag: gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW},
+		},
+		Inputs: []Input{{Address: 10, Line: 1, Counter: true, CounterAddress: 100}},
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() { _ = s.Serve(l) }()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := &testClient{t: t, conn: conn}
+
+	assert.Equal(t, []byte{FuncReadCoils, 1, 0x01}, c.call(FuncReadCoils, 0, 0, 0, 2))
+	assert.Equal(t, []byte{FuncWriteSingleCoil, 0, 1, 0xff, 0}, c.call(FuncWriteSingleCoil, 0, 1, 0xff, 0))
+	coil1.AssertCalled(t, "SetBulk", byte(1))
+	assert.Equal(t, []byte{FuncReadCoils, 1, 0x03}, c.call(FuncReadCoils, 0, 0, 0, 2))
+	assert.Equal(t, []byte{FuncWriteMultipleCoils, 0, 0, 0, 2}, c.call(FuncWriteMultipleCoils, 0, 0, 0, 2, 1, 0x02))
+	coil0.AssertCalled(t, "SetBulk", byte(0))
+	assert.Equal(t, []byte{FuncReadCoils, 1, 0x02}, c.call(FuncReadCoils, 0, 0, 0, 2))
+
+	assert.Equal(t, []byte{FuncReadDiscreteInputs, 1, 0x01}, c.call(FuncReadDiscreteInputs, 0, 10, 0, 1))
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp := c.call(FuncReadInputRegisters, 0, 100, 0, 2)
+		if resp[5] == 3 || time.Now().After(deadline) {
+			assert.Equal(t, []byte{FuncReadInputRegisters, 4, 0, 0, 0, 3}, resp)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// exceptions
+	assert.Equal(t, []byte{FuncReadCoils | 0x80, ExceptionIllegalDataAddress}, c.call(FuncReadCoils, 0, 1, 0, 2))
+	assert.Equal(t, []byte{FuncReadInputRegisters | 0x80, ExceptionIllegalDataAddress}, c.call(FuncReadInputRegisters, 0, 101, 0, 2))
+	assert.Equal(t, []byte{0x83, ExceptionIllegalFunction}, c.call(0x03, 0, 0, 0, 1))
+	assert.Equal(t, []byte{FuncWriteSingleCoil | 0x80, ExceptionIllegalDataValue}, c.call(FuncWriteSingleCoil, 0, 0, 0x12, 0x34))
+	// unmapped coil in range must not change mapped ones
+	assert.Equal(t, []byte{FuncWriteMultipleCoils | 0x80, ExceptionIllegalDataAddress}, c.call(FuncWriteMultipleCoils, 0, 1, 0, 2, 1, 0x03))
+	coil1.AssertNumberOfCalls(t, "SetBulk", 2)
+}
+
+func TestCounterFailure(t *testing.T) {
+	chip := &gpio_mock.MockChip{}
+	ev := &gpio_mock.MockEvent{}
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{}, errors.New("EIO"))
+	ev.On("Close").Return(nil)
+	chip.On("GetLineEventWith", uint32(1), gpio.RequestFlag(0), gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "", gpio.EventOptions{}).Return(ev, nil)
+	s, err := New(chip, Config{Inputs: []Input{{Address: 0, Line: 1, Counter: true, CounterAddress: 0}}})
+	require.NoError(t, err)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp := s.handle([]byte{FuncReadInputRegisters, 0, 0, 0, 2})
+		if resp[0]&0x80 != 0 || time.Now().After(deadline) {
+			assert.Equal(t, []byte{FuncReadInputRegisters | 0x80, ExceptionDeviceFailure}, resp)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(t, s.Close())
+	assert.True(t, gpio.IsClosed(s.Close()))
+	ev.AssertNumberOfCalls(t, "Close", 1)
+}
+
+func TestConfigCheck(t *testing.T) {
+	chip := &gpio_mock.MockChip{}
+	lines := testLines()
+	chip.On("OpenLinesWith", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(lines, nil)
+	_, err := New(chip, Config{Coils: []Coil{{Address: 3, Line: 1}, {Address: 3, Line: 2}}})
+	assert.Error(t, err)
+	// already opened lines are released
+	lines.AssertNumberOfCalls(t, "Close", 1)
+}
+
+func TestPackBits(t *testing.T) {
+	assert.Equal(t, []byte{1, 0x05}, packBits([]byte{1, 0, 1}))
+	assert.Equal(t, []byte{2, 0xff, 0x01}, packBits([]byte{1, 1, 1, 1, 1, 1, 1, 1, 1}))
+}
@@ -0,0 +1,521 @@
+// Bridge between GPIO lines and MQTT broker.
+// Inputs publish retained value to state topic, every edge to edge topic
+// and retained count of edges since bridge start to count topic.
+// Outputs are driven by messages to command topic and publish retained
+// state after each change. Availability topic is retained "online" while
+// bridge runs and "offline" after it stops, also set by broker as last will
+// when connection is lost.
+//
+// MQTT client is built in, QoS 0 only, no TLS.
+package mqttbridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+// Line to bridge.
+type Pin struct {
+	Line uint32
+
+	// topic segment, default line name from LineInfo, or offset when line is unnamed
+	Name string
+
+	Output bool
+
+	// GPIOHANDLE_REQUEST_ACTIVE_LOW inverts state and command payloads, bias is for inputs
+	Flag gpio.RequestFlag
+
+	// outputs only, value set when bridge opens line
+	Initial byte
+
+	// inputs only, see gpio.EventOptions.Debounce
+	Debounce time.Duration
+
+	// inputs only, Home Assistant binary_sensor device_class like "door" or "motion"
+	DeviceClass string
+}
+
+// Topic templates, "{prefix}" and "{name}" are replaced with Config.Prefix and Pin.Name.
+type Topics struct {
+	State        string
+	Edge         string
+	Count        string
+	Command      string
+	Availability string
+}
+
+var DefaultTopics = Topics{
+	State:        "{prefix}/{name}/state",
+	Edge:         "{prefix}/{name}/edge",
+	Count:        "{prefix}/{name}/edges",
+	Command:      "{prefix}/{name}/set",
+	Availability: "{prefix}/status",
+}
+
+const (
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+)
+
+type Config struct {
+	// broker TCP address "host:port"
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+
+	// default 30s
+	KeepAlive time.Duration
+
+	// default "gpio/" + chip name
+	Prefix string
+
+	// empty fields are taken from DefaultTopics
+	Topics Topics
+
+	// LineInfo consumer of bridged lines, empty uses chip default
+	Consumer string
+
+	Discovery Discovery
+
+	Pins []Pin
+
+	// errors which don't stop bridge, like failed command write, default log.Printf
+	Logf func(format string, args ...interface{})
+}
+
+// Edge message payload.
+type EdgeJSON struct {
+	Edge      string    `json:"edge"`
+	Value     byte      `json:"value"`
+	Timestamp uint64    `json:"timestamp_ns"`
+	Time      time.Time `json:"time"`
+	Seqno     uint32    `json:"seqno"`
+}
+
+type Bridge struct {
+	chip gpio.Chiper
+	cfg  Config
+	pins []*pin
+
+	mu   sync.Mutex
+	conn *mqttConn
+
+	// readInput goroutines, they live until Close
+	wg sync.WaitGroup
+
+	// published entity configs by topic, see Discovery
+	discovery map[string]DiscoveryJSON
+}
+
+type pin struct {
+	Pin
+	stateTopic   string
+	edgeTopic    string
+	countTopic   string
+	commandTopic string
+
+	lines gpio.Lineser // output
+	event gpio.Eventer // input
+
+	// input edges from readInput to Run, closed when reading stops
+	edgech chan gpio.Event
+
+	mu    sync.Mutex
+	value byte   // output
+	edges uint64 // input
+	err   error  // input, why readInput stopped
+}
+
+// Edges queued while Run is slow, more are only counted.
+const edgeBuffer = 64
+
+// Requests all pin lines, they are held until Close.
+// Call Run to connect to broker.
+func New(chip gpio.Chiper, cfg Config) (*Bridge, error) {
+	const tag = "mqttbridge.New"
+	if cfg.Broker == "" {
+		return nil, errors.NotValidf("%s empty Broker", tag)
+	}
+	info := chip.Info()
+	chipName := (&gpio.ChipEntry{Info: info}).Name()
+	if cfg.Prefix == "" {
+		cfg.Prefix = "gpio/" + chipName
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "gpio-" + chipName
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = 30 * time.Second
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+	cfg.Topics = cfg.Topics.withDefaults()
+	cfg.Topics.Availability = strings.Replace(cfg.Topics.Availability, "{prefix}", cfg.Prefix, -1)
+
+	b := &Bridge{chip: chip, cfg: cfg}
+	names := make(map[string]uint32, len(cfg.Pins))
+	for _, p := range cfg.Pins {
+		if p.Name == "" {
+			li, err := chip.LineInfo(p.Line)
+			if err != nil {
+				b.Close()
+				return nil, errors.Annotatef(err, "%s line=%d", tag, p.Line)
+			}
+			if p.Name = li.NameString(); p.Name == "" {
+				p.Name = strconv.FormatUint(uint64(p.Line), 10)
+			}
+		}
+		if other, ok := names[p.Name]; ok {
+			b.Close()
+			return nil, errors.NotValidf("%s duplicate pin name=%s lines=%d,%d", tag, p.Name, other, p.Line)
+		}
+		names[p.Name] = p.Line
+		bp, err := b.openPin(p)
+		if err != nil {
+			b.Close()
+			return nil, errors.Annotatef(err, "%s line=%d", tag, p.Line)
+		}
+		b.pins = append(b.pins, bp)
+		if !bp.Output {
+			b.wg.Add(1)
+			go b.readInput(bp)
+		}
+	}
+	return b, nil
+}
+
+func (t Topics) withDefaults() Topics {
+	if t.State == "" {
+		t.State = DefaultTopics.State
+	}
+	if t.Edge == "" {
+		t.Edge = DefaultTopics.Edge
+	}
+	if t.Count == "" {
+		t.Count = DefaultTopics.Count
+	}
+	if t.Command == "" {
+		t.Command = DefaultTopics.Command
+	}
+	if t.Availability == "" {
+		t.Availability = DefaultTopics.Availability
+	}
+	return t
+}
+
+func (b *Bridge) topic(template, name string) string {
+	return strings.NewReplacer("{prefix}", b.cfg.Prefix, "{name}", name).Replace(template)
+}
+
+func (b *Bridge) openPin(p Pin) (*pin, error) {
+	bp := &pin{
+		Pin:          p,
+		stateTopic:   b.topic(b.cfg.Topics.State, p.Name),
+		edgeTopic:    b.topic(b.cfg.Topics.Edge, p.Name),
+		countTopic:   b.topic(b.cfg.Topics.Count, p.Name),
+		commandTopic: b.topic(b.cfg.Topics.Command, p.Name),
+	}
+	var err error
+	if p.Output {
+		bp.value = p.Initial
+		bp.lines, err = b.chip.OpenLinesWith(gpio.GPIOHANDLE_REQUEST_OUTPUT|p.Flag, b.cfg.Consumer,
+			gpio.LineOptions{DefaultValues: []byte{p.Initial}}, p.Line)
+	} else {
+		bp.edgech = make(chan gpio.Event, edgeBuffer)
+		bp.event, err = b.chip.GetLineEventWith(p.Line, p.Flag, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, b.cfg.Consumer,
+			gpio.EventOptions{Debounce: p.Debounce})
+	}
+	return bp, err
+}
+
+// Releases all lines. Bridge must not be running.
+func (b *Bridge) Close() error {
+	var firstErr error
+	for _, p := range b.pins {
+		var err error
+		if p.lines != nil {
+			err = p.lines.Close()
+		}
+		if p.event != nil {
+			err = p.event.Close()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	// closed events end blocked Wait in readInput
+	b.wg.Wait()
+	b.pins = nil
+	return firstErr
+}
+
+// Connects to broker and bridges until `stop` is closed or connection fails.
+// Returns nil after stop, may be called again after error to reconnect.
+func (b *Bridge) Run(stop <-chan struct{}) error {
+	const tag = "mqttbridge.Run"
+	conn, err := dialMQTT(b.cfg.Broker, connectOptions{
+		ClientID:    b.cfg.ClientID,
+		Username:    b.cfg.Username,
+		Password:    b.cfg.Password,
+		KeepAlive:   b.cfg.KeepAlive,
+		WillTopic:   b.cfg.Topics.Availability,
+		WillPayload: []byte(PayloadOffline),
+		WillRetain:  true,
+	})
+	if err != nil {
+		return errors.Annotate(err, tag)
+	}
+	b.mu.Lock()
+	b.conn = conn
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.conn = nil
+		b.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	errch := make(chan error, len(b.pins)+2)
+	var wg sync.WaitGroup
+	defer func() {
+		close(done)
+		conn.Close()
+		wg.Wait()
+	}()
+
+	var subs []string
+	for _, p := range b.pins {
+		if p.Output {
+			subs = append(subs, p.commandTopic)
+		}
+	}
+	if b.cfg.Discovery.Prefix != "" {
+		// retained configs of removed pins come back here and get cleared
+		subs = append(subs, b.discoveryFilter())
+	}
+	if len(subs) != 0 {
+		if err = conn.subscribe(subs...); err != nil {
+			return errors.Annotate(err, tag)
+		}
+	}
+	// edges seen while disconnected are counted, publishAll sends current state
+	for _, p := range b.pins {
+		p.drainEdges()
+	}
+	if err = b.publishDiscovery(); err != nil {
+		return errors.Annotate(err, tag)
+	}
+	if err = b.publishAll(); err != nil {
+		return errors.Annotate(err, tag)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errch <- conn.readLoop(b.cfg.KeepAlive*3/2, b.handleMessage)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(b.cfg.KeepAlive / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err := conn.ping(); err != nil {
+					errch <- err
+					return
+				}
+			}
+		}
+	}()
+	for _, p := range b.pins {
+		if !p.Output {
+			wg.Add(1)
+			go func(p *pin) {
+				defer wg.Done()
+				errch <- b.watchInput(p, done)
+			}(p)
+		}
+	}
+
+	select {
+	case <-stop:
+		_ = conn.publish(b.cfg.Topics.Availability, []byte(PayloadOffline), true)
+		_ = conn.disconnect()
+		return nil
+	case err = <-errch:
+		return errors.Annotate(err, tag)
+	}
+}
+
+// Retained current values, edge counts and availability.
+func (b *Bridge) publishAll() error {
+	for _, p := range b.pins {
+		var v byte
+		if p.Output {
+			p.mu.Lock()
+			v = p.value
+			p.mu.Unlock()
+		} else {
+			var err error
+			if v, err = p.event.Read(); err != nil {
+				return errors.Annotatef(err, "read line=%d", p.Line)
+			}
+			p.mu.Lock()
+			n := p.edges
+			p.mu.Unlock()
+			if err := b.publish(p.countTopic, formatCount(n), true); err != nil {
+				return err
+			}
+		}
+		if err := b.publish(p.stateTopic, formatValue(v), true); err != nil {
+			return err
+		}
+	}
+	return b.publish(b.cfg.Topics.Availability, []byte(PayloadOnline), true)
+}
+
+func (b *Bridge) publish(topic string, payload []byte, retain bool) error {
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+	if conn == nil {
+		return errors.Errorf("not connected")
+	}
+	return conn.publish(topic, payload, retain)
+}
+
+// Counts edges until Close, Run publishes them.
+func (b *Bridge) readInput(p *pin) {
+	defer b.wg.Done()
+	defer close(p.edgech)
+	for {
+		e, err := p.event.Wait(0)
+		if err != nil {
+			if !gpio.IsClosed(err) {
+				p.mu.Lock()
+				p.err = errors.Annotatef(err, "line=%d", p.Line)
+				p.mu.Unlock()
+			}
+			return
+		}
+		p.mu.Lock()
+		p.edges++
+		p.mu.Unlock()
+		select {
+		case p.edgech <- e:
+		default:
+		}
+	}
+}
+
+func (p *pin) drainEdges() {
+	for {
+		select {
+		case _, ok := <-p.edgech:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *pin) readErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		return gpio.ErrClosed
+	}
+	return p.err
+}
+
+func (b *Bridge) watchInput(p *pin, done <-chan struct{}) error {
+	for {
+		var e gpio.Event
+		select {
+		case <-done:
+			return nil
+		case next, ok := <-p.edgech:
+			if !ok {
+				return p.readErr()
+			}
+			e = next
+		}
+		msg := EdgeJSON{Edge: "falling", Timestamp: e.Timestamp, Time: e.Time(), Seqno: e.Seqno}
+		if e.ID == gpio.GPIOEVENT_EVENT_RISING_EDGE {
+			msg.Edge, msg.Value = "rising", 1
+		}
+		payload, _ := json.Marshal(msg)
+		if err := b.publish(p.edgeTopic, payload, false); err != nil {
+			return err
+		}
+		if err := b.publish(p.stateTopic, formatValue(msg.Value), true); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		n := p.edges
+		p.mu.Unlock()
+		if err := b.publish(p.countTopic, formatCount(n), true); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *Bridge) handleMessage(topic string, payload []byte) {
+	if b.handleDiscovery(topic, payload) {
+		return
+	}
+	for _, p := range b.pins {
+		if p.Output && p.commandTopic == topic {
+			v, ok := parseValue(payload)
+			if !ok {
+				// garbage from broker must not stop bridge
+				return
+			}
+			p.mu.Lock()
+			p.lines.SetBulk(v)
+			err := p.lines.Flush()
+			if err == nil {
+				p.value = v
+			}
+			state := p.value
+			p.mu.Unlock()
+			if err != nil {
+				b.cfg.Logf("mqttbridge: command topic=%s value=%d: %v", topic, v, err)
+			}
+			// optimistic subscribers revert to real state after failed write
+			_ = b.publish(p.stateTopic, formatValue(state), true)
+			return
+		}
+	}
+}
+
+func formatValue(v byte) []byte   { return []byte(fmt.Sprintf("%d", v)) }
+func formatCount(n uint64) []byte { return []byte(strconv.FormatUint(n, 10)) }
+
+// Accepts 0/1, on/off, true/false, high/low in any case.
+func parseValue(payload []byte) (byte, bool) {
+	switch strings.ToLower(strings.TrimSpace(string(payload))) {
+	case "1", "on", "true", "high":
+		return 1, true
+	case "0", "off", "false", "low":
+		return 0, true
+	}
+	return 0, false
+}
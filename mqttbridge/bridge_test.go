@@ -0,0 +1,404 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/temoto/gpio-cdev-go"
+	gpio_mock "github.com/temoto/gpio-cdev-go/mock"
+)
+
+type testMessage struct {
+	Topic   string
+	Payload string
+	Retain  bool
+}
+
+// In-process stand-in for MQTT broker.
+type testBroker struct {
+	l        net.Listener
+	messages chan testMessage
+
+	mu       sync.Mutex
+	conns    map[net.Conn][]string
+	retained map[string]string
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tb := &testBroker{
+		l:        l,
+		messages: make(chan testMessage, 100),
+		conns:    make(map[net.Conn][]string),
+		retained: make(map[string]string),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go tb.serve(conn)
+		}
+	}()
+	return tb
+}
+
+func (tb *testBroker) Close() { tb.l.Close() }
+
+func (tb *testBroker) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	header, body, err := readPacket(r)
+	if err != nil || header>>4 != packetConnect {
+		conn.Close()
+		return
+	}
+	will := decodeTestWill(body)
+	_, _ = conn.Write([]byte{packetConnack << 4, 2, 0, 0})
+	tb.mu.Lock()
+	tb.conns[conn] = nil
+	tb.mu.Unlock()
+	graceful := false
+	defer func() {
+		tb.mu.Lock()
+		delete(tb.conns, conn)
+		tb.mu.Unlock()
+		conn.Close()
+		if !graceful && will != nil {
+			tb.route(*will)
+		}
+	}()
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case packetPublish:
+			topic, payload, _ := decodePublish(header, body)
+			tb.route(testMessage{Topic: topic, Payload: string(payload), Retain: header&1 != 0})
+		case packetSubscribe:
+			var topics []string
+			for rest := body[2:]; len(rest) != 0; rest = rest[1:] {
+				var topic string
+				topic, rest, _ = readString(rest)
+				topics = append(topics, topic)
+			}
+			ack := []byte{packetSuback << 4, byte(2 + len(topics)), body[0], body[1]}
+			ack = append(ack, make([]byte, len(topics))...)
+			tb.mu.Lock()
+			tb.conns[conn] = append(tb.conns[conn], topics...)
+			_, _ = conn.Write(ack)
+			for topic, payload := range tb.retained {
+				for _, filter := range topics {
+					if topicMatch(filter, topic) {
+						_, _ = conn.Write(testPublishPacket(topic, payload))
+					}
+				}
+			}
+			tb.mu.Unlock()
+		case packetPingreq:
+			_, _ = conn.Write([]byte{packetPingresp << 4, 0})
+		case packetDisconnect:
+			graceful = true
+			return
+		}
+	}
+}
+
+func decodeTestWill(body []byte) *testMessage {
+	_, rest, _ := readString(body)
+	flags := rest[1]
+	_, rest, _ = readString(rest[4:])
+	if flags&0x04 == 0 {
+		return nil
+	}
+	topic, rest, _ := readString(rest)
+	payload, _, _ := readString(rest)
+	return &testMessage{Topic: topic, Payload: payload, Retain: flags&0x20 != 0}
+}
+
+// Stores retained message and forwards to subscribers.
+func (tb *testBroker) route(m testMessage) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if m.Retain && m.Payload == "" {
+		delete(tb.retained, m.Topic)
+	} else if m.Retain {
+		tb.retained[m.Topic] = m.Payload
+	}
+	packet := testPublishPacket(m.Topic, m.Payload)
+	for conn, filters := range tb.conns {
+		for _, filter := range filters {
+			if topicMatch(filter, m.Topic) {
+				_, _ = conn.Write(packet)
+			}
+		}
+	}
+	tb.messages <- m
+}
+
+func testPublishPacket(topic, payload string) []byte {
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	packet := appendLength([]byte{packetPublish << 4}, len(body))
+	return append(packet, body...)
+}
+
+// MQTT filter with + and # wildcards.
+func topicMatch(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+func (tb *testBroker) expect(t *testing.T, topic string) testMessage {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case m := <-tb.messages:
+			if m.Topic == topic {
+				return m
+			}
+		case <-timeout:
+			t.Fatalf("no message topic=%s", topic)
+		}
+	}
+}
+
+func testChip() *gpio_mock.MockChip {
+	var info gpio.ChipInfo
+	copy(info.Name[:], "gpiochip0")
+	info.Lines = 8
+	chip := &gpio_mock.MockChip{}
+	chip.On("Info").Return(info)
+	return chip
+}
+
+func TestBridge(t *testing.T) {
+	tb := newTestBroker(t)
+	defer tb.Close()
+
+	chip := testChip()
+	var btn gpio.LineInfo
+	copy(btn.Name[:], "BTN")
+	chip.On("LineInfo", uint32(1)).Return(btn, nil)
+	ev := &gpio_mock.MockEvent{}
+	ev.On("Read").Return(byte(0), nil)
+	press, closed := make(chan struct{}), make(chan struct{})
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{EventData: gpio.EventData{Timestamp: 42, ID: gpio.GPIOEVENT_EVENT_RISING_EDGE}, Seqno: 1}, nil).
+		Run(func(mock.Arguments) { <-press }).Once()
+	// real Eventer ends blocked Wait on Close
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{}, gpio.ErrClosed).Run(func(mock.Arguments) { <-closed })
+	ev.On("Close").Return(nil).Run(func(mock.Arguments) { close(closed) })
+	chip.On("GetLineEventWith", uint32(1), gpio.GPIOHANDLE_REQUEST_BIAS_PULL_UP, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "", gpio.EventOptions{}).Return(ev, nil)
+	lines := &gpio_mock.MockLines{}
+	lines.On("SetBulk", byte(1)).Return()
+	lines.On("Flush").Return(nil)
+	lines.On("Close").Return(nil)
+	chip.On("OpenLinesWith", gpio.GPIOHANDLE_REQUEST_OUTPUT, "", gpio.LineOptions{DefaultValues: []byte{0}}, uint32(2)).Return(lines, nil)
+
+	b, err := New(chip, Config{
+		Broker: tb.l.Addr().String(),
+		Topics: Topics{Command: "{prefix}/{name}/cmd"},
+		Pins: []Pin{
+			{Line: 1, Flag: gpio.GPIOHANDLE_REQUEST_BIAS_PULL_UP},
+			{Line: 2, Name: "led", Output: true},
+		},
+	})
+	require.NoError(t, err)
+	defer b.Close()
+	stop := make(chan struct{})
+	errch := make(chan error, 1)
+	go func() { errch <- b.Run(stop) }()
+
+	assert.Equal(t, testMessage{"gpio/gpiochip0/BTN/state", "0", true}, tb.expect(t, "gpio/gpiochip0/BTN/state"))
+	assert.Equal(t, testMessage{"gpio/gpiochip0/led/state", "0", true}, tb.expect(t, "gpio/gpiochip0/led/state"))
+	assert.Equal(t, testMessage{"gpio/gpiochip0/status", PayloadOnline, true}, tb.expect(t, "gpio/gpiochip0/status"))
+	close(press)
+
+	m := tb.expect(t, "gpio/gpiochip0/BTN/edge")
+	assert.False(t, m.Retain)
+	var edge EdgeJSON
+	require.NoError(t, json.Unmarshal([]byte(m.Payload), &edge))
+	assert.Equal(t, "rising", edge.Edge)
+	assert.Equal(t, byte(1), edge.Value)
+	assert.Equal(t, uint64(42), edge.Timestamp)
+	assert.Equal(t, testMessage{"gpio/gpiochip0/BTN/state", "1", true}, tb.expect(t, "gpio/gpiochip0/BTN/state"))
+
+	tb.route(testMessage{Topic: "gpio/gpiochip0/led/cmd", Payload: "ON"})
+	assert.Equal(t, testMessage{"gpio/gpiochip0/led/state", "1", true}, tb.expect(t, "gpio/gpiochip0/led/state"))
+	lines.AssertCalled(t, "SetBulk", byte(1))
+
+	close(stop)
+	require.NoError(t, <-errch)
+	assert.Equal(t, testMessage{"gpio/gpiochip0/status", PayloadOffline, true}, tb.expect(t, "gpio/gpiochip0/status"))
+}
+
+func TestCommandFlushError(t *testing.T) {
+	tb := newTestBroker(t)
+	defer tb.Close()
+	chip := testChip()
+	lines := &gpio_mock.MockLines{}
+	lines.On("SetBulk", mock.Anything).Return()
+	lines.On("Flush").Return(errors.New("EIO")).Once()
+	lines.On("Flush").Return(nil)
+	lines.On("Close").Return(nil)
+	chip.On("OpenLinesWith", gpio.GPIOHANDLE_REQUEST_OUTPUT, "", gpio.LineOptions{DefaultValues: []byte{0}}, uint32(2)).Return(lines, nil)
+
+	logged := make(chan string, 1)
+	b, err := New(chip, Config{
+		Broker: tb.l.Addr().String(),
+		Pins:   []Pin{{Line: 2, Name: "led", Output: true}},
+		Logf:   func(format string, args ...interface{}) { logged <- fmt.Sprintf(format, args...) },
+	})
+	require.NoError(t, err)
+	defer b.Close()
+	stop := make(chan struct{})
+	errch := make(chan error, 1)
+	go func() { errch <- b.Run(stop) }()
+	assert.Equal(t, testMessage{"gpio/gpiochip0/led/state", "0", true}, tb.expect(t, "gpio/gpiochip0/led/state"))
+	tb.expect(t, "gpio/gpiochip0/status")
+
+	// failed write republishes real state and keeps bridge running
+	tb.route(testMessage{Topic: "gpio/gpiochip0/led/set", Payload: "1"})
+	assert.Equal(t, testMessage{"gpio/gpiochip0/led/state", "0", true}, tb.expect(t, "gpio/gpiochip0/led/state"))
+	assert.Contains(t, <-logged, "EIO")
+
+	tb.route(testMessage{Topic: "gpio/gpiochip0/led/set", Payload: "1"})
+	assert.Equal(t, testMessage{"gpio/gpiochip0/led/state", "1", true}, tb.expect(t, "gpio/gpiochip0/led/state"))
+
+	close(stop)
+	require.NoError(t, <-errch)
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	assert.Equal(t, "1", tb.retained["gpio/gpiochip0/led/state"])
+}
+
+func TestLastWill(t *testing.T) {
+	tb := newTestBroker(t)
+	defer tb.Close()
+	b, err := New(testChip(), Config{Broker: tb.l.Addr().String(), Prefix: "house"})
+	require.NoError(t, err)
+	defer b.Close()
+	errch := make(chan error, 1)
+	go func() { errch <- b.Run(nil) }()
+	tb.expect(t, "house/status")
+
+	// broker side drop, not graceful DISCONNECT
+	tb.mu.Lock()
+	for conn := range tb.conns {
+		conn.Close()
+	}
+	tb.mu.Unlock()
+	assert.Error(t, <-errch)
+	assert.Equal(t, testMessage{"house/status", PayloadOffline, true}, tb.expect(t, "house/status"))
+}
+
+func TestDiscovery(t *testing.T) {
+	tb := newTestBroker(t)
+	defer tb.Close()
+	// left from previous run with pin which is now removed
+	tb.retained["homeassistant/binary_sensor/gpio-gpiochip0/OLD/config"] = `{"name":"OLD"}`
+	tb.retained["homeassistant/binary_sensor/other-node/X/config"] = `{"name":"X"}`
+
+	chip := testChip()
+	ev := &gpio_mock.MockEvent{}
+	ev.On("Read").Return(byte(1), nil)
+	closed := make(chan struct{})
+	ev.On("Wait", time.Duration(0)).Return(gpio.Event{}, gpio.ErrClosed).Run(func(mock.Arguments) { <-closed })
+	ev.On("Close").Return(nil).Run(func(mock.Arguments) { close(closed) })
+	chip.On("GetLineEventWith", uint32(1), gpio.RequestFlag(0), gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "", gpio.EventOptions{}).Return(ev, nil)
+	lines := &gpio_mock.MockLines{}
+	lines.On("Close").Return(nil)
+	chip.On("OpenLinesWith", gpio.GPIOHANDLE_REQUEST_OUTPUT, "", gpio.LineOptions{DefaultValues: []byte{0}}, uint32(2)).Return(lines, nil)
+
+	b, err := New(chip, Config{
+		Broker:    tb.l.Addr().String(),
+		Discovery: Discovery{Prefix: "homeassistant", DeviceName: "Board"},
+		Pins: []Pin{
+			{Line: 1, Name: "door.front", DeviceClass: "door"},
+			{Line: 2, Name: "relay", Output: true},
+		},
+	})
+	require.NoError(t, err)
+	defer b.Close()
+	stop := make(chan struct{})
+	errch := make(chan error, 1)
+	go func() { errch <- b.Run(stop) }()
+
+	var c DiscoveryJSON
+	m := tb.expect(t, "homeassistant/binary_sensor/gpio-gpiochip0/door_front/config")
+	assert.True(t, m.Retain)
+	require.NoError(t, json.Unmarshal([]byte(m.Payload), &c))
+	assert.Equal(t, "door.front", c.Name)
+	assert.Equal(t, "gpio-gpiochip0_door_front", c.UniqueID)
+	assert.Equal(t, "door", c.DeviceClass)
+	assert.Equal(t, "gpio/gpiochip0/door.front/state", c.StateTopic)
+	assert.Equal(t, "gpio/gpiochip0/status", c.AvailabilityTopic)
+	assert.Equal(t, "Board", c.Device.Name)
+	assert.Equal(t, []string{"gpio-gpiochip0"}, c.Device.Identifiers)
+
+	m = tb.expect(t, "homeassistant/sensor/gpio-gpiochip0/door_front_edges/config")
+	c = DiscoveryJSON{}
+	require.NoError(t, json.Unmarshal([]byte(m.Payload), &c))
+	assert.Equal(t, "gpio/gpiochip0/door.front/edges", c.StateTopic)
+	assert.Equal(t, "total_increasing", c.StateClass)
+
+	m = tb.expect(t, "homeassistant/switch/gpio-gpiochip0/relay/config")
+	c = DiscoveryJSON{}
+	require.NoError(t, json.Unmarshal([]byte(m.Payload), &c))
+	assert.Equal(t, "gpio/gpiochip0/relay/set", c.CommandTopic)
+
+	assert.Equal(t, testMessage{"homeassistant/binary_sensor/gpio-gpiochip0/OLD/config", "", true},
+		tb.expect(t, "homeassistant/binary_sensor/gpio-gpiochip0/OLD/config"))
+	close(stop)
+	require.NoError(t, <-errch)
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	assert.NotContains(t, tb.retained, "homeassistant/binary_sensor/gpio-gpiochip0/OLD/config")
+	assert.Contains(t, tb.retained, "homeassistant/binary_sensor/other-node/X/config")
+	assert.Equal(t, "0", tb.retained["gpio/gpiochip0/door.front/edges"])
+}
+
+func TestParseValue(t *testing.T) {
+	for _, c := range []struct {
+		in string
+		v  byte
+		ok bool
+	}{{"1", 1, true}, {"ON", 1, true}, {" true\n", 1, true}, {"off", 0, true}, {"0", 0, true}, {"2", 0, false}, {"", 0, false}} {
+		v, ok := parseValue([]byte(c.in))
+		assert.Equal(t, c.v, v, "in=%q", c.in)
+		assert.Equal(t, c.ok, ok, "in=%q", c.in)
+	}
+}
+
+func TestRemainingLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151, 2097152} {
+		b := appendLength([]byte{packetPublish << 4}, n)
+		b = append(b, make([]byte, n)...)
+		_, body, err := readPacket(bufio.NewReader(bytes.NewReader(b)))
+		require.NoError(t, err)
+		assert.Equal(t, n, len(body))
+	}
+}
@@ -0,0 +1,166 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/temoto/gpio-cdev-go"
+)
+
+// Home Assistant MQTT discovery, disabled when Prefix is empty.
+// https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+// Inputs appear as binary_sensor and sensor of edge count, outputs as switch.
+// All entities belong to one device per bridge.
+type Discovery struct {
+	// usually "homeassistant"
+	Prefix string
+
+	// discovery topic segment and device id, default Config.ClientID
+	NodeID string
+
+	// default chip label, or name when label is empty
+	DeviceName string
+}
+
+// Entity config payload, only fields used by bridge.
+type DiscoveryJSON struct {
+	Name                string          `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	StateTopic          string          `json:"state_topic"`
+	CommandTopic        string          `json:"command_topic,omitempty"`
+	PayloadOn           string          `json:"payload_on,omitempty"`
+	PayloadOff          string          `json:"payload_off,omitempty"`
+	StateOn             string          `json:"state_on,omitempty"`
+	StateOff            string          `json:"state_off,omitempty"`
+	DeviceClass         string          `json:"device_class,omitempty"`
+	StateClass          string          `json:"state_class,omitempty"`
+	Icon                string          `json:"icon,omitempty"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	PayloadAvailable    string          `json:"payload_available"`
+	PayloadNotAvailable string          `json:"payload_not_available"`
+	Device              DiscoveryDevice `json:"device"`
+}
+
+type DiscoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Model        string   `json:"model,omitempty"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+}
+
+// Home Assistant allows only these in node_id and object_id.
+var discoveryIDInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+func discoveryID(s string) string { return discoveryIDInvalid.ReplaceAllString(s, "_") }
+
+func (b *Bridge) nodeID() string {
+	if b.cfg.Discovery.NodeID != "" {
+		return discoveryID(b.cfg.Discovery.NodeID)
+	}
+	return discoveryID(b.cfg.ClientID)
+}
+
+// Matches config topics of all entities of this bridge, current and removed.
+func (b *Bridge) discoveryFilter() string {
+	return b.cfg.Discovery.Prefix + "/+/" + b.nodeID() + "/+/config"
+}
+
+func (b *Bridge) discoveryTopic(component, objectID string) string {
+	return b.cfg.Discovery.Prefix + "/" + component + "/" + b.nodeID() + "/" + discoveryID(objectID) + "/config"
+}
+
+// Returns config payload by topic for all pins.
+func (b *Bridge) discoveryConfigs() map[string]DiscoveryJSON {
+	info := b.chip.Info()
+	entry := gpio.ChipEntry{Info: info}
+	device := DiscoveryDevice{
+		Identifiers:  []string{b.nodeID()},
+		Name:         b.cfg.Discovery.DeviceName,
+		Model:        entry.Label(),
+		Manufacturer: "Linux GPIO " + entry.Name(),
+	}
+	if device.Name == "" {
+		if device.Name = entry.Label(); device.Name == "" {
+			device.Name = entry.Name()
+		}
+	}
+	base := DiscoveryJSON{
+		AvailabilityTopic:   b.cfg.Topics.Availability,
+		PayloadAvailable:    PayloadOnline,
+		PayloadNotAvailable: PayloadOffline,
+		Device:              device,
+	}
+
+	configs := make(map[string]DiscoveryJSON, len(b.pins)*2)
+	for _, p := range b.pins {
+		uid := b.nodeID() + "_" + discoveryID(p.Name)
+		if p.Output {
+			c := base
+			c.Name = p.Name
+			c.UniqueID = uid
+			c.StateTopic = p.stateTopic
+			c.CommandTopic = p.commandTopic
+			c.PayloadOn, c.PayloadOff = "1", "0"
+			c.StateOn, c.StateOff = "1", "0"
+			configs[b.discoveryTopic("switch", p.Name)] = c
+			continue
+		}
+		c := base
+		c.Name = p.Name
+		c.UniqueID = uid
+		c.StateTopic = p.stateTopic
+		c.PayloadOn, c.PayloadOff = "1", "0"
+		c.DeviceClass = p.DeviceClass
+		configs[b.discoveryTopic("binary_sensor", p.Name)] = c
+
+		c = base
+		c.Name = p.Name + " edges"
+		c.UniqueID = uid + "_edges"
+		c.StateTopic = p.countTopic
+		c.StateClass = "total_increasing"
+		c.Icon = "mdi:counter"
+		configs[b.discoveryTopic("sensor", p.Name+"_edges")] = c
+	}
+	return configs
+}
+
+func (b *Bridge) publishDiscovery() error {
+	if b.cfg.Discovery.Prefix == "" {
+		return nil
+	}
+	b.discovery = b.discoveryConfigs()
+	topics := make([]string, 0, len(b.discovery))
+	for topic := range b.discovery {
+		topics = append(topics, topic)
+	}
+	// stable order is easier to follow in broker log
+	sort.Strings(topics)
+	for _, topic := range topics {
+		payload, _ := json.Marshal(b.discovery[topic])
+		if err := b.publish(topic, payload, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clears retained config of entity which is no longer in Config.Pins.
+// Empty retained payload removes entity in Home Assistant.
+// Returns false if topic is not discovery config of this bridge.
+func (b *Bridge) handleDiscovery(topic string, payload []byte) bool {
+	if b.cfg.Discovery.Prefix == "" {
+		return false
+	}
+	parts := strings.Split(topic, "/")
+	prefix := strings.Split(b.cfg.Discovery.Prefix, "/")
+	if len(parts) != len(prefix)+4 || parts[len(parts)-1] != "config" || parts[len(prefix)+1] != b.nodeID() ||
+		strings.Join(parts[:len(prefix)], "/") != b.cfg.Discovery.Prefix {
+		return false
+	}
+	if _, ok := b.discovery[topic]; !ok && len(payload) != 0 {
+		_ = b.publish(topic, nil, true)
+	}
+	return true
+}
@@ -0,0 +1,268 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Minimal MQTT 3.1.1 client, QoS 0 only, just enough for bridge.
+// http://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.html
+
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+type connectOptions struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+
+	// last will, sent by broker when connection is lost without DISCONNECT
+	WillTopic   string
+	WillPayload []byte
+	WillRetain  bool
+}
+
+type mqttConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	wmu    sync.Mutex
+	nextID uint16
+}
+
+func dialMQTT(address string, opt connectOptions) (*mqttConn, error) {
+	const tag = "MQTT connect"
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return nil, errors.Annotate(err, tag)
+	}
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err = c.write(packetConnect<<4, encodeConnect(opt)); err != nil {
+		conn.Close()
+		return nil, errors.Annotate(err, tag)
+	}
+	header, body, err := readPacket(c.r)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Annotate(err, tag)
+	}
+	if header>>4 != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, errors.Errorf("%s unexpected packet type=%d len=%d", tag, header>>4, len(body))
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, errors.Errorf("%s refused code=%d", tag, body[1])
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func encodeConnect(opt connectOptions) []byte {
+	var flags byte = 0x02 // clean session
+	if opt.WillTopic != "" {
+		flags |= 0x04
+		if opt.WillRetain {
+			flags |= 0x20
+		}
+	}
+	if opt.Username != "" {
+		flags |= 0x80
+		if opt.Password != "" {
+			flags |= 0x40
+		}
+	}
+	b := appendString(nil, "MQTT")
+	b = append(b, 4, flags)
+	b = appendUint16(b, uint16(opt.KeepAlive/time.Second))
+	b = appendString(b, opt.ClientID)
+	if opt.WillTopic != "" {
+		b = appendString(b, opt.WillTopic)
+		b = appendBytes(b, opt.WillPayload)
+	}
+	if opt.Username != "" {
+		b = appendString(b, opt.Username)
+		if opt.Password != "" {
+			b = appendString(b, opt.Password)
+		}
+	}
+	return b
+}
+
+func (c *mqttConn) Close() error { return c.conn.Close() }
+
+func (c *mqttConn) publish(topic string, payload []byte, retain bool) error {
+	var header byte = packetPublish << 4
+	if retain {
+		header |= 1
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.write(header, body)
+}
+
+// SUBACK is consumed by readLoop.
+func (c *mqttConn) subscribe(topics ...string) error {
+	c.wmu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.wmu.Unlock()
+	body := appendUint16(nil, id)
+	for _, t := range topics {
+		body = appendString(body, t)
+		body = append(body, 0) // QoS 0
+	}
+	return c.write(packetSubscribe<<4|0x02, body)
+}
+
+func (c *mqttConn) ping() error { return c.write(packetPingreq<<4, nil) }
+
+// Graceful close, broker discards last will.
+func (c *mqttConn) disconnect() error {
+	err := c.write(packetDisconnect<<4, nil)
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Reads packets until error, calls fun for each incoming PUBLISH.
+// `timeout` should be greater than keep alive, so silent broker is detected.
+func (c *mqttConn) readLoop(timeout time.Duration, fun func(topic string, payload []byte)) error {
+	for {
+		if timeout != 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		header, body, err := readPacket(c.r)
+		if err != nil {
+			return err
+		}
+		switch header >> 4 {
+		case packetPublish:
+			topic, payload, err := decodePublish(header, body)
+			if err != nil {
+				return err
+			}
+			fun(topic, payload)
+		case packetSuback:
+			if len(body) < 2 {
+				return errors.Errorf("MQTT SUBACK too short")
+			}
+			for _, code := range body[2:] {
+				if code == 0x80 {
+					return errors.Errorf("MQTT subscribe refused")
+				}
+			}
+		case packetPingresp:
+		default:
+			return errors.Errorf("MQTT unexpected packet type=%d", header>>4)
+		}
+	}
+}
+
+func decodePublish(header byte, body []byte) (string, []byte, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return "", nil, err
+	}
+	if qos := (header >> 1) & 3; qos != 0 {
+		// packet id, we subscribe with QoS 0 so broker should not send it
+		if len(rest) < 2 {
+			return "", nil, errors.Errorf("MQTT PUBLISH too short")
+		}
+		rest = rest[2:]
+	}
+	return topic, rest, nil
+}
+
+func (c *mqttConn) write(header byte, body []byte) error {
+	b := make([]byte, 0, 5+len(body))
+	b = append(b, header)
+	b = appendLength(b, len(body))
+	b = append(b, body...)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(b)
+	return err
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, uint(0)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.Errorf("MQTT malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+func appendLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendBytes(b []byte, p []byte) []byte {
+	b = appendUint16(b, uint16(len(p)))
+	return append(b, p...)
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.Errorf("MQTT string too short")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.Errorf("MQTT string too short")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
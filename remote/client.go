@@ -0,0 +1,299 @@
+// Access GPIO chip of another machine, like your desk Raspberry Pi from laptop.
+// Server exports local gpio.Chiper over TCP or Unix socket with net/rpc,
+// Dial returns gpio.Chiper which forwards all calls to it. Edge events are
+// waited by server and streamed back over the same connection.
+//
+//	chip, err := remote.Dial("tcp", "raspberrypi:7340")   // was gpio.Open("/dev/gpiochip0", "app")
+//
+// No authentication or encryption, use over trusted network or SSH tunnel.
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+// Default TCP port of gpio-remoted.
+const DefaultPort = "7340"
+
+type client struct {
+	rpc    *rpc.Client
+	info   gpio.ChipInfo
+	closed uint32
+}
+
+// compile-time interface check
+var _ gpio.Chiper = &client{}
+var _ gpio.Lineser = &remoteLines{}
+var _ gpio.Eventer = &remoteEvent{}
+var _ gpio.LineWatcher = &remoteWatcher{}
+
+// Connects to Server, network is "tcp" or "unix".
+// Consumer label is server side concern, see gpio.Open.
+// You must call Chiper.Close()
+func Dial(network, address string) (gpio.Chiper, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, errors.Annotate(err, "remote.Dial")
+	}
+	return NewClient(conn)
+}
+
+// Same as Dial over existing connection. Client owns conn.
+func NewClient(conn io.ReadWriteCloser) (gpio.Chiper, error) {
+	c := &client{rpc: rpc.NewClient(conn)}
+	if err := c.call("Info", NoArgs{}, &c.info); err != nil {
+		_ = c.rpc.Close()
+		return nil, errors.Annotate(err, "remote.Info")
+	}
+	return c, nil
+}
+
+func (c *client) call(method string, args, reply interface{}) error {
+	return decodeError(c.rpc.Call(serviceName+"."+method, args, reply))
+}
+
+// Releases all lines, events and watcher opened with this client.
+func (c *client) Close() error {
+	if atomic.AddUint32(&c.closed, 1) == 1 {
+		return c.rpc.Close()
+	}
+	return gpio.ErrClosed
+}
+
+func (c *client) Info() gpio.ChipInfo { return c.info }
+
+func (c *client) LineInfo(line uint32) (gpio.LineInfo, error) {
+	var li gpio.LineInfo
+	err := c.call("LineInfo", line, &li)
+	return li, err
+}
+
+func (c *client) Snapshot() ([]gpio.LineState, error) {
+	var states []gpio.LineState
+	err := c.call("Snapshot", NoArgs{}, &states)
+	return states, err
+}
+
+func (c *client) FindLines(names ...string) ([]uint32, error) {
+	var offsets []uint32
+	err := c.call("FindLines", names, &offsets)
+	return offsets, err
+}
+
+func (c *client) OpenLines(flag gpio.RequestFlag, consumerLabel string, lines ...uint32) (gpio.Lineser, error) {
+	return c.OpenLinesWith(flag, consumerLabel, gpio.LineOptions{}, lines...)
+}
+
+func (c *client) OpenLinesWith(flag gpio.RequestFlag, consumerLabel string, opt gpio.LineOptions, lines ...uint32) (gpio.Lineser, error) {
+	return c.openLines(OpenLinesArgs{Flag: flag, Consumer: consumerLabel, Opt: opt, Lines: lines})
+}
+
+func (c *client) OpenLinesByName(flag gpio.RequestFlag, consumerLabel string, names ...string) (gpio.Lineser, error) {
+	return c.openLines(OpenLinesArgs{Flag: flag, Consumer: consumerLabel, Names: names})
+}
+
+func (c *client) openLines(args OpenLinesArgs) (gpio.Lineser, error) {
+	var reply OpenLinesReply
+	if err := c.call("OpenLines", args, &reply); err != nil {
+		return nil, err
+	}
+	l := &remoteLines{client: c, handle: reply.Handle, offsets: reply.Offsets}
+	if args.Flag&gpio.GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		copy(l.values[:], args.Opt.DefaultValues)
+	}
+	return l, nil
+}
+
+func (c *client) GetLineEvent(line uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string) (gpio.Eventer, error) {
+	return c.GetLineEventWith(line, flag, events, consumerLabel, gpio.EventOptions{})
+}
+
+func (c *client) GetLineEventWith(line uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string, opt gpio.EventOptions) (gpio.Eventer, error) {
+	return c.getEvent(EventArgs{Lines: []uint32{line}, Flag: flag, Events: events, Consumer: consumerLabel, Opt: opt})
+}
+
+func (c *client) GetLinesEvent(lines []uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string, opt gpio.EventOptions) (gpio.Eventer, error) {
+	return c.getEvent(EventArgs{Lines: lines, Flag: flag, Events: events, Consumer: consumerLabel, Opt: opt, Multi: true})
+}
+
+func (c *client) getEvent(args EventArgs) (gpio.Eventer, error) {
+	var reply EventReply
+	if err := c.call("GetLineEvent", args, &reply); err != nil {
+		return nil, err
+	}
+	return &remoteEvent{client: c, handle: reply.Handle, bufSize: reply.BufferSize}, nil
+}
+
+func (c *client) WatchLineInfo(lines ...uint32) (gpio.LineWatcher, error) {
+	var h Handle
+	if err := c.call("WatchLineInfo", lines, &h); err != nil {
+		return nil, err
+	}
+	return &remoteWatcher{client: c, handle: h}, nil
+}
+
+// Output values are buffered locally by SetFunc/SetBulk until Flush,
+// same as local lines, so Flush is the only round trip.
+type remoteLines struct {
+	client  *client
+	handle  Handle
+	offsets []uint32
+	mu      sync.Mutex
+	values  [gpio.GPIOHANDLES_MAX]byte
+}
+
+func (self *remoteLines) Close() error {
+	return self.client.call("LinesClose", self.handle, &NoArgs{})
+}
+
+func (self *remoteLines) LineOffsets() []uint32 { return self.offsets }
+
+func (self *remoteLines) SetFunc(line uint32) gpio.LineSetFunc {
+	idx := -1
+	for i, l := range self.offsets {
+		if l == line {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		panic(fmt.Sprintf("code error invalid line=%d registered=%v", line, self.offsets))
+	}
+	return func(value byte) {
+		self.mu.Lock()
+		self.values[idx] = value
+		self.mu.Unlock()
+	}
+}
+
+func (self *remoteLines) SetBulk(bs ...byte) {
+	self.mu.Lock()
+	copy(self.values[:], bs)
+	self.mu.Unlock()
+}
+
+func (self *remoteLines) Flush() error {
+	self.mu.Lock()
+	args := ValuesArgs{Handle: self.handle, Values: append([]byte(nil), self.values[:len(self.offsets)]...)}
+	self.mu.Unlock()
+	return self.client.call("LinesFlush", args, &NoArgs{})
+}
+
+func (self *remoteLines) Read() (gpio.HandleData, error) {
+	var data gpio.HandleData
+	err := self.client.call("LinesRead", self.handle, &data)
+	return data, err
+}
+
+// Same buffer semantics as local lines: OUTPUT drives `defaultValues` or
+// local buffer, INPUT refreshes local buffer from server.
+func (self *remoteLines) SetConfig(flag gpio.RequestFlag, defaultValues ...byte) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	n := len(self.offsets)
+	args := SetConfigArgs{Handle: self.handle, Flag: flag}
+	if flag&gpio.GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		args.DefaultValues = append([]byte(nil), self.values[:n]...)
+		copy(args.DefaultValues, defaultValues)
+	}
+	if err := self.client.call("LinesSetConfig", args, &NoArgs{}); err != nil {
+		return err
+	}
+	if flag&gpio.GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		copy(self.values[:n], args.DefaultValues)
+		return nil
+	}
+	var data gpio.HandleData
+	if err := self.client.call("LinesRead", self.handle, &data); err != nil {
+		return err
+	}
+	copy(self.values[:n], data.Values[:n])
+	return nil
+}
+
+func (self *remoteLines) GetValues(mask uint64) (uint64, error) {
+	var bits uint64
+	err := self.client.call("LinesGetValues", ValuesArgs{Handle: self.handle, Mask: mask}, &bits)
+	return bits, err
+}
+
+// Local buffer is updated too, so next Flush doesn't undo this write.
+func (self *remoteLines) SetValues(mask, bits uint64) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if err := self.client.call("LinesSetValues", ValuesArgs{Handle: self.handle, Mask: mask, Bits: bits}, &NoArgs{}); err != nil {
+		return err
+	}
+	for i := range self.offsets {
+		if mask&(1<<uint(i)) != 0 {
+			self.values[i] = byte((bits >> uint(i)) & 1)
+		}
+	}
+	return nil
+}
+
+type remoteEvent struct {
+	client  *client
+	handle  Handle
+	bufSize uint32
+}
+
+func (self *remoteEvent) Close() error {
+	return self.client.call("EventClose", self.handle, &NoArgs{})
+}
+
+func (self *remoteEvent) Read() (byte, error) {
+	var v byte
+	err := self.client.call("EventRead", self.handle, &v)
+	return v, err
+}
+
+// Blocks on server, timeout is applied there and doesn't include network latency.
+func (self *remoteEvent) Wait(timeout time.Duration) (gpio.Event, error) {
+	var e gpio.Event
+	err := self.client.call("EventWait", WaitArgs{Handle: self.handle, Timeout: timeout}, &e)
+	return e, err
+}
+
+// Returns 0 when server is unreachable.
+func (self *remoteEvent) Dropped() uint64 {
+	var n uint64
+	_ = self.client.call("EventDropped", self.handle, &n)
+	return n
+}
+
+func (self *remoteEvent) BufferSize() uint32 { return self.bufSize }
+
+type remoteWatcher struct {
+	client *client
+	handle Handle
+}
+
+func (self *remoteWatcher) Close() error {
+	return self.client.call("WatcherClose", self.handle, &NoArgs{})
+}
+
+func (self *remoteWatcher) Watch(line uint32) (gpio.LineInfo, error) {
+	var li gpio.LineInfo
+	err := self.client.call("WatcherWatch", LineArgs{Handle: self.handle, Line: line}, &li)
+	return li, err
+}
+
+func (self *remoteWatcher) Unwatch(line uint32) error {
+	return self.client.call("WatcherUnwatch", LineArgs{Handle: self.handle, Line: line}, &NoArgs{})
+}
+
+func (self *remoteWatcher) Wait(timeout time.Duration) (gpio.LineInfoChanged, error) {
+	var e gpio.LineInfoChanged
+	err := self.client.call("WatcherWait", WaitArgs{Handle: self.handle, Timeout: timeout}, &e)
+	return e, err
+}
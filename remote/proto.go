@@ -0,0 +1,102 @@
+package remote
+
+import (
+	"net/rpc"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+// net/rpc service name
+const serviceName = "GPIO"
+
+// Server side id of opened Lineser, Eventer or LineWatcher.
+type Handle uint64
+
+type NoArgs struct{ Unused bool }
+
+type OpenLinesArgs struct {
+	Flag     gpio.RequestFlag
+	Consumer string
+	Opt      gpio.LineOptions
+	Lines    []uint32
+	// OpenLinesByName when not empty, Lines is ignored
+	Names []string
+}
+
+type OpenLinesReply struct {
+	Handle  Handle
+	Offsets []uint32
+}
+
+type ValuesArgs struct {
+	Handle Handle
+	Mask   uint64
+	Bits   uint64
+	// Flush only, in LineOffsets order
+	Values []byte
+}
+
+type SetConfigArgs struct {
+	Handle        Handle
+	Flag          gpio.RequestFlag
+	DefaultValues []byte
+}
+
+type EventArgs struct {
+	Lines    []uint32
+	Flag     gpio.RequestFlag
+	Events   gpio.EventFlag
+	Consumer string
+	Opt      gpio.EventOptions
+	// GetLinesEvent instead of GetLineEventWith
+	Multi bool
+}
+
+type EventReply struct {
+	Handle     Handle
+	BufferSize uint32
+}
+
+type WaitArgs struct {
+	Handle  Handle
+	Timeout time.Duration
+}
+
+type LineArgs struct {
+	Handle Handle
+	Line   uint32
+}
+
+// net/rpc sends only error text, so well known errors are matched by message
+// to restore gpio.IsClosed, gpio.IsTimeout and errors.IsNotFound like checks.
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == rpc.ErrShutdown {
+		return gpio.ErrClosed
+	}
+	se, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	msg := string(se)
+	switch {
+	case msg == gpio.ErrClosed.Error():
+		return gpio.ErrClosed
+	case msg == gpio.ErrTimeout.Error():
+		return gpio.ErrTimeout
+	case strings.HasSuffix(msg, " not found"):
+		return errors.NewNotFound(nil, msg)
+	case strings.HasSuffix(msg, " not valid"):
+		return errors.NewNotValid(nil, msg)
+	case strings.HasSuffix(msg, " not supported"):
+		return errors.NewNotSupported(nil, msg)
+	case strings.HasSuffix(msg, " already exists"):
+		return errors.NewAlreadyExists(nil, msg)
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,224 @@
+package remote
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/temoto/gpio-cdev-go"
+	gpio_mock "github.com/temoto/gpio-cdev-go/mock"
+	"github.com/temoto/gpio-cdev-go/sim"
+)
+
+// Serves mock chip on localhost, returns connected client.
+func testPair(t *testing.T) (*gpio_mock.MockChip, gpio.Chiper, func()) {
+	var info gpio.ChipInfo
+	copy(info.Name[:], "gpiochip0")
+	info.Lines = 8
+	chip := &gpio_mock.MockChip{}
+	chip.On("Info").Return(info)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = NewServer(chip).Serve(l) }()
+	c, err := Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	return chip, c, func() {
+		c.Close()
+		l.Close()
+	}
+}
+
+func TestChip(t *testing.T) {
+	chip, c, done := testPair(t)
+	defer done()
+	info := c.Info()
+	assert.Equal(t, uint32(8), info.Lines)
+	assert.Equal(t, "name=gpiochip0 label= lines=8", info.String())
+
+	li := gpio.LineInfo{LineOffset: 3, Flags: gpio.GPIOLINE_FLAG_IS_OUT}
+	copy(li.Name[:], "LED")
+	chip.On("LineInfo", uint32(3)).Return(li, nil)
+	got, err := c.LineInfo(3)
+	require.NoError(t, err)
+	assert.Equal(t, li, got)
+
+	chip.On("FindLines", "BTN").Return([]uint32(nil), errors.NotFoundf("line name=BTN"))
+	_, err = c.FindLines("BTN")
+	assert.True(t, errors.IsNotFound(err), "err=%v", err)
+
+	assert.NoError(t, c.Close())
+	assert.True(t, gpio.IsClosed(c.Close()))
+	_, err = c.LineInfo(3)
+	assert.True(t, gpio.IsClosed(err), "err=%v", err)
+}
+
+func TestLines(t *testing.T) {
+	chip, c, done := testPair(t)
+	defer done()
+	ml := &gpio_mock.MockLines{}
+	var want [gpio.GPIOHANDLES_MAX]byte
+	want[0], want[1] = 1, 1
+	ml.On("LineOffsets").Return([]uint32{1, 2})
+	ml.On("SetBulk", byte(1), byte(1)).Return()
+	ml.On("Flush").Return(nil)
+	ml.On("SetValues", uint64(2), uint64(0)).Return(nil)
+	ml.On("Close").Return(nil)
+	ml.On("Read").Return(gpio.HandleData{Values: want}, nil)
+	chip.On("OpenLinesWith", gpio.GPIOHANDLE_REQUEST_OUTPUT, "", gpio.LineOptions{DefaultValues: []byte{1, 0}}, uint32(1), uint32(2)).Return(ml, nil)
+
+	lines, err := c.OpenLinesWith(gpio.GPIOHANDLE_REQUEST_OUTPUT, "", gpio.LineOptions{DefaultValues: []byte{1, 0}}, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 2}, lines.LineOffsets())
+
+	// default values are kept in local buffer, SetFunc changes only one
+	lines.SetFunc(2)(1)
+	require.NoError(t, lines.Flush())
+	ml.AssertCalled(t, "SetBulk", byte(1), byte(1))
+
+	data, err := lines.Read()
+	require.NoError(t, err)
+	assert.Equal(t, want, data.Values)
+
+	assert.NoError(t, lines.SetValues(2, 0))
+
+	assert.NoError(t, lines.Close())
+	assert.True(t, gpio.IsClosed(lines.Close()))
+	ml.AssertNumberOfCalls(t, "Close", 1)
+}
+
+func TestEvent(t *testing.T) {
+	chip, c, done := testPair(t)
+	defer done()
+	me := &gpio_mock.MockEvent{}
+	me.On("BufferSize").Return(uint32(16))
+	me.On("Wait", time.Duration(0)).Return(gpio.Event{EventData: gpio.EventData{Timestamp: 42, ID: gpio.GPIOEVENT_EVENT_RISING_EDGE}, Seqno: 1, LineOffset: 5}, nil).Once()
+	me.On("Wait", time.Millisecond).Return(gpio.Event{}, gpio.ErrTimeout)
+	closed := make(chan struct{})
+	me.On("Close").Return(nil).Run(func(mock.Arguments) { close(closed) })
+	chip.On("GetLineEventWith", uint32(5), gpio.RequestFlag(0), gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "app", gpio.EventOptions{}).Return(me, nil)
+
+	ev, err := c.GetLineEvent(5, 0, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "app")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(16), ev.BufferSize())
+	e, err := ev.Wait(0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), e.Timestamp)
+	assert.Equal(t, gpio.EventID(gpio.GPIOEVENT_EVENT_RISING_EDGE), e.ID)
+	assert.Equal(t, uint32(5), e.LineOffset)
+	_, err = ev.Wait(time.Millisecond)
+	assert.True(t, gpio.IsTimeout(err), "err=%v", err)
+
+	// disconnect releases server side event request
+	c.Close()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event request not closed after client disconnect")
+	}
+}
+
+func TestDisconnectDuringWait(t *testing.T) {
+	dev := sim.New("gpiochip0", "test", "BUTTON")
+	chip := dev.Open("remoted")
+	defer chip.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() { _ = NewServer(chip).Serve(l) }()
+
+	c, err := Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	ev, err := c.GetLineEvent(0, 0, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "app")
+	require.NoError(t, err)
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := ev.Wait(0)
+		waiting <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+	<-waiting
+
+	// server releases line while Wait(0) is still pending
+	c, err = Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ev, err = c.GetLineEvent(0, 0, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "app")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	assert.NoError(t, ev.Close())
+}
+
+func TestServerClose(t *testing.T) {
+	dev := sim.New("gpiochip0", "test", "LED")
+	chip := dev.Open("remoted")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := NewServer(chip)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	c, err := Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.OpenLines(gpio.GPIOHANDLE_REQUEST_OUTPUT, "app", 0)
+	require.NoError(t, err)
+
+	// connected client must not block shutdown
+	require.NoError(t, srv.Close())
+	assert.True(t, gpio.IsClosed(srv.Close()))
+	assert.Error(t, <-served)
+	closed := make(chan error, 1)
+	go func() { closed <- chip.Close() }()
+	select {
+	case err = <-closed:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("chip Close blocked by lines of remote session")
+	}
+	_, err = c.OpenLines(gpio.GPIOHANDLE_REQUEST_OUTPUT, "app", 0)
+	assert.Error(t, err)
+}
+
+func TestLinesBuffer(t *testing.T) {
+	dev := sim.New("gpiochip0", "test", "A", "B")
+	chip := dev.Open("remoted")
+	srv := NewServer(chip)
+	defer chip.Close()
+	defer srv.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	c, err := Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	lines, err := c.OpenLines(gpio.GPIOHANDLE_REQUEST_OUTPUT, "app", 0, 1)
+	require.NoError(t, err)
+	defer lines.Close()
+	// SetValues is kept in local buffer, Flush doesn't undo it
+	require.NoError(t, lines.SetValues(1, 1))
+	lines.SetFunc(1)(1)
+	require.NoError(t, lines.Flush())
+	assert.Equal(t, byte(1), dev.Level(0))
+	assert.Equal(t, byte(1), dev.Level(1))
+
+	// INPUT refreshes buffer, OUTPUT without values drives it
+	require.NoError(t, lines.SetConfig(gpio.GPIOHANDLE_REQUEST_INPUT))
+	require.NoError(t, dev.Drive(0, 0))
+	require.NoError(t, lines.SetConfig(gpio.GPIOHANDLE_REQUEST_INPUT))
+	require.NoError(t, lines.SetConfig(gpio.GPIOHANDLE_REQUEST_OUTPUT))
+	assert.Equal(t, byte(0), dev.Level(0))
+	assert.Equal(t, byte(1), dev.Level(1))
+}
@@ -0,0 +1,427 @@
+package remote
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+// Exports local chip to remote clients, see Dial.
+// Each connection owns lines, events and watcher it opened,
+// they are released when connection closes.
+type Server struct {
+	chip gpio.Chiper
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	sessions  map[io.ReadWriteCloser]*session
+}
+
+// Server doesn't close chip, call Server.Close before chip Close,
+// otherwise chip Close waits for lines held by connected clients.
+func NewServer(chip gpio.Chiper) *Server {
+	return &Server{
+		chip:      chip,
+		listeners: make(map[net.Listener]struct{}),
+		sessions:  make(map[io.ReadWriteCloser]*session),
+	}
+}
+
+// Closes listeners, connections and releases everything clients opened.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return gpio.ErrClosed
+	}
+	s.closed = true
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+	for conn, sess := range s.sessions {
+		_ = conn.Close()
+		sess.close()
+	}
+	return nil
+}
+
+// Accepts connections until listener fails, serving each in own goroutine.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return gpio.ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return errors.Annotate(err, "remote.Serve")
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// Serves single connection, blocks until client disconnects or Server.Close.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	sess := &session{
+		chip:     s.chip,
+		lines:    make(map[Handle]*sessionLines),
+		events:   make(map[Handle]gpio.Eventer),
+		watchers: make(map[Handle]gpio.LineWatcher),
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	s.sessions[conn] = sess
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, conn)
+		s.mu.Unlock()
+	}()
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(serviceName, sess); err != nil {
+		panic("code error RegisterName: " + err.Error())
+	}
+	// net/rpc waits for pending calls after read fails, blocked Wait
+	// would hold session forever, closing lines first unblocks it
+	srv.ServeConn(&sessionConn{ReadWriteCloser: conn, sess: sess})
+	sess.close()
+}
+
+// Closes session on first read error, before net/rpc waits for pending calls.
+type sessionConn struct {
+	io.ReadWriteCloser
+	sess *session
+}
+
+func (c *sessionConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if err != nil {
+		c.sess.close()
+	}
+	return n, err
+}
+
+// RPC methods of one connection, see net/rpc for signature rules.
+type session struct {
+	chip gpio.Chiper
+
+	mu       sync.Mutex
+	closed   bool
+	next     Handle
+	lines    map[Handle]*sessionLines
+	events   map[Handle]gpio.Eventer
+	watchers map[Handle]gpio.LineWatcher
+}
+
+// SetBulk+Flush pair must not interleave with other Flush on same handle.
+type sessionLines struct {
+	gpio.Lineser
+	mu sync.Mutex
+}
+
+func (s *session) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for h, l := range s.lines {
+		_ = l.Close()
+		delete(s.lines, h)
+	}
+	for h, e := range s.events {
+		_ = e.Close()
+		delete(s.events, h)
+	}
+	for h, w := range s.watchers {
+		_ = w.Close()
+		delete(s.watchers, h)
+	}
+}
+
+func (s *session) newHandle() Handle {
+	s.next++
+	return s.next
+}
+
+func (s *session) getLines(h Handle) (*sessionLines, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.lines[h]; ok {
+		return l, nil
+	}
+	return nil, gpio.ErrClosed
+}
+
+func (s *session) getEvent(h Handle) (gpio.Eventer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.events[h]; ok {
+		return e, nil
+	}
+	return nil, gpio.ErrClosed
+}
+
+func (s *session) getWatcher(h Handle) (gpio.LineWatcher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, ok := s.watchers[h]; ok {
+		return w, nil
+	}
+	return nil, gpio.ErrClosed
+}
+
+// Strips annotations from errors recognized by decodeError.
+func encodeError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case gpio.IsClosed(errors.Cause(err)):
+		return gpio.ErrClosed
+	case gpio.IsTimeout(errors.Cause(err)):
+		return gpio.ErrTimeout
+	}
+	return err
+}
+
+func (s *session) Info(_ NoArgs, reply *gpio.ChipInfo) error {
+	*reply = s.chip.Info()
+	return nil
+}
+
+func (s *session) LineInfo(line uint32, reply *gpio.LineInfo) error {
+	li, err := s.chip.LineInfo(line)
+	*reply = li
+	return encodeError(err)
+}
+
+func (s *session) Snapshot(_ NoArgs, reply *[]gpio.LineState) error {
+	states, err := s.chip.Snapshot()
+	*reply = states
+	return encodeError(err)
+}
+
+func (s *session) FindLines(names []string, reply *[]uint32) error {
+	offsets, err := s.chip.FindLines(names...)
+	*reply = offsets
+	return encodeError(err)
+}
+
+func (s *session) OpenLines(args OpenLinesArgs, reply *OpenLinesReply) error {
+	var l gpio.Lineser
+	var err error
+	if len(args.Names) != 0 {
+		l, err = s.chip.OpenLinesByName(args.Flag, args.Consumer, args.Names...)
+	} else {
+		l, err = s.chip.OpenLinesWith(args.Flag, args.Consumer, args.Opt, args.Lines...)
+	}
+	if err != nil {
+		return encodeError(err)
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = l.Close()
+		return gpio.ErrClosed
+	}
+	reply.Handle = s.newHandle()
+	s.lines[reply.Handle] = &sessionLines{Lineser: l}
+	s.mu.Unlock()
+	reply.Offsets = l.LineOffsets()
+	return nil
+}
+
+func (s *session) LinesClose(h Handle, _ *NoArgs) error {
+	s.mu.Lock()
+	l, ok := s.lines[h]
+	delete(s.lines, h)
+	s.mu.Unlock()
+	if !ok {
+		return gpio.ErrClosed
+	}
+	return encodeError(l.Close())
+}
+
+func (s *session) LinesRead(h Handle, reply *gpio.HandleData) error {
+	l, err := s.getLines(h)
+	if err != nil {
+		return err
+	}
+	data, err := l.Read()
+	*reply = data
+	return encodeError(err)
+}
+
+func (s *session) LinesFlush(args ValuesArgs, _ *NoArgs) error {
+	l, err := s.getLines(args.Handle)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.SetBulk(args.Values...)
+	return encodeError(l.Flush())
+}
+
+func (s *session) LinesSetConfig(args SetConfigArgs, _ *NoArgs) error {
+	l, err := s.getLines(args.Handle)
+	if err != nil {
+		return err
+	}
+	return encodeError(l.SetConfig(args.Flag, args.DefaultValues...))
+}
+
+func (s *session) LinesGetValues(args ValuesArgs, reply *uint64) error {
+	l, err := s.getLines(args.Handle)
+	if err != nil {
+		return err
+	}
+	bits, err := l.GetValues(args.Mask)
+	*reply = bits
+	return encodeError(err)
+}
+
+func (s *session) LinesSetValues(args ValuesArgs, _ *NoArgs) error {
+	l, err := s.getLines(args.Handle)
+	if err != nil {
+		return err
+	}
+	return encodeError(l.SetValues(args.Mask, args.Bits))
+}
+
+func (s *session) GetLineEvent(args EventArgs, reply *EventReply) error {
+	var e gpio.Eventer
+	var err error
+	if args.Multi {
+		e, err = s.chip.GetLinesEvent(args.Lines, args.Flag, args.Events, args.Consumer, args.Opt)
+	} else if len(args.Lines) == 1 {
+		e, err = s.chip.GetLineEventWith(args.Lines[0], args.Flag, args.Events, args.Consumer, args.Opt)
+	} else {
+		err = errors.NotValidf("single line event with lines=%v", args.Lines)
+	}
+	if err != nil {
+		return encodeError(err)
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = e.Close()
+		return gpio.ErrClosed
+	}
+	reply.Handle = s.newHandle()
+	s.events[reply.Handle] = e
+	s.mu.Unlock()
+	reply.BufferSize = e.BufferSize()
+	return nil
+}
+
+func (s *session) EventClose(h Handle, _ *NoArgs) error {
+	s.mu.Lock()
+	e, ok := s.events[h]
+	delete(s.events, h)
+	s.mu.Unlock()
+	if !ok {
+		return gpio.ErrClosed
+	}
+	return encodeError(e.Close())
+}
+
+func (s *session) EventRead(h Handle, reply *byte) error {
+	e, err := s.getEvent(h)
+	if err != nil {
+		return err
+	}
+	v, err := e.Read()
+	*reply = v
+	return encodeError(err)
+}
+
+func (s *session) EventWait(args WaitArgs, reply *gpio.Event) error {
+	e, err := s.getEvent(args.Handle)
+	if err != nil {
+		return err
+	}
+	data, err := e.Wait(args.Timeout)
+	*reply = data
+	return encodeError(err)
+}
+
+func (s *session) EventDropped(h Handle, reply *uint64) error {
+	e, err := s.getEvent(h)
+	if err != nil {
+		return err
+	}
+	*reply = e.Dropped()
+	return nil
+}
+
+func (s *session) WatchLineInfo(lines []uint32, reply *Handle) error {
+	w, err := s.chip.WatchLineInfo(lines...)
+	if err != nil {
+		return encodeError(err)
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = w.Close()
+		return gpio.ErrClosed
+	}
+	*reply = s.newHandle()
+	s.watchers[*reply] = w
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *session) WatcherClose(h Handle, _ *NoArgs) error {
+	s.mu.Lock()
+	w, ok := s.watchers[h]
+	delete(s.watchers, h)
+	s.mu.Unlock()
+	if !ok {
+		return gpio.ErrClosed
+	}
+	return encodeError(w.Close())
+}
+
+func (s *session) WatcherWatch(args LineArgs, reply *gpio.LineInfo) error {
+	w, err := s.getWatcher(args.Handle)
+	if err != nil {
+		return err
+	}
+	li, err := w.Watch(args.Line)
+	*reply = li
+	return encodeError(err)
+}
+
+func (s *session) WatcherUnwatch(args LineArgs, _ *NoArgs) error {
+	w, err := s.getWatcher(args.Handle)
+	if err != nil {
+		return err
+	}
+	return encodeError(w.Unwatch(args.Line))
+}
+
+func (s *session) WatcherWait(args WaitArgs, reply *gpio.LineInfoChanged) error {
+	w, err := s.getWatcher(args.Handle)
+	if err != nil {
+		return err
+	}
+	e, err := w.Wait(args.Timeout)
+	*reply = e
+	return encodeError(err)
+}
@@ -0,0 +1,203 @@
+package sim
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+type chip struct {
+	dev             *Device
+	defaultConsumer string
+	closed          uint32
+	watching        uint32
+
+	// same as fdArc: chip itself holds one reference, each opened
+	// lines/event/watcher holds another, Close waits for all of them
+	mu   sync.Mutex
+	refs int
+	done chan struct{}
+}
+
+// compile-time interface check
+var _ gpio.Chiper = &chip{}
+
+func (c *chip) incref() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refs == 0 || atomic.LoadUint32(&c.closed) != 0 {
+		return false
+	}
+	c.refs++
+	return true
+}
+
+func (c *chip) decref() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refs--
+	switch {
+	case c.refs == 0:
+		close(c.done)
+	case c.refs < 0:
+		panic("code error excess chip.decref")
+	}
+}
+
+// Blocks until all lines, events and watcher opened from this chip are closed,
+// same as gpio.Open chip.
+func (c *chip) Close() error {
+	if atomic.AddUint32(&c.closed, 1) == 1 {
+		c.decref()
+		<-c.done
+		return nil
+	}
+	return gpio.ErrClosed
+}
+
+func (c *chip) Info() gpio.ChipInfo { return c.dev.info }
+
+func (c *chip) LineInfo(line uint32) (gpio.LineInfo, error) {
+	return c.dev.LineInfo(line)
+}
+
+func (c *chip) Snapshot() ([]gpio.LineState, error) { return gpio.ChipSnapshot(c) }
+
+func (c *chip) FindLines(names ...string) ([]uint32, error) {
+	c.dev.mu.Lock()
+	lineNames := make([]string, len(c.dev.lines))
+	for i, l := range c.dev.lines {
+		lineNames[i] = l.name
+	}
+	c.dev.mu.Unlock()
+	return gpio.MatchLineNames(gpio.ChipEntry{Info: c.dev.info}, lineNames, names...)
+}
+
+func (c *chip) consumer(label string) string {
+	if label == "" {
+		return c.defaultConsumer
+	}
+	return label
+}
+
+func (c *chip) OpenLines(flag gpio.RequestFlag, consumerLabel string, lines ...uint32) (gpio.Lineser, error) {
+	return c.OpenLinesWith(flag, consumerLabel, gpio.LineOptions{}, lines...)
+}
+
+func (c *chip) OpenLinesByName(flag gpio.RequestFlag, consumerLabel string, names ...string) (gpio.Lineser, error) {
+	offsets, err := c.FindLines(names...)
+	if err != nil {
+		return nil, err
+	}
+	return c.OpenLines(flag, consumerLabel, offsets...)
+}
+
+func (c *chip) OpenLinesWith(flag gpio.RequestFlag, consumerLabel string, opt gpio.LineOptions, offsets ...uint32) (gpio.Lineser, error) {
+	const tag = "GET_LINEHANDLE"
+	if err := checkFlag(flag); err != nil {
+		return nil, err
+	}
+	if len(opt.DefaultValues) > len(offsets) {
+		return nil, errors.NotValidf("DefaultValues len=%d for lines=%d", len(opt.DefaultValues), len(offsets))
+	}
+	if opt.Debounce != 0 && flag&gpio.GPIOHANDLE_REQUEST_INPUT == 0 {
+		return nil, errors.NotValidf("flags=%x Debounce without INPUT", uint32(flag))
+	}
+	if !c.incref() {
+		return nil, gpio.ErrClosed
+	}
+	d := c.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.request(offsets, flag, c.consumer(consumerLabel)); err != nil {
+		c.decref()
+		return nil, errors.Annotatef(err, "%s lines=%v", tag, offsets)
+	}
+	l := &lines{chip: c, offsets: append([]uint32(nil), offsets...)}
+	copy(l.values[:], opt.DefaultValues)
+	if flag&gpio.GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		for i, o := range offsets {
+			d.lines[o].setLogical(l.values[i])
+		}
+	}
+	return l, nil
+}
+
+func (c *chip) GetLineEvent(line uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string) (gpio.Eventer, error) {
+	return c.GetLineEventWith(line, flag, events, consumerLabel, gpio.EventOptions{})
+}
+
+func (c *chip) GetLineEventWith(line uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string, opt gpio.EventOptions) (gpio.Eventer, error) {
+	return c.GetLinesEvent([]uint32{line}, flag, events, consumerLabel, opt)
+}
+
+func (c *chip) GetLinesEvent(offsets []uint32, flag gpio.RequestFlag, events gpio.EventFlag, consumerLabel string, opt gpio.EventOptions) (gpio.Eventer, error) {
+	const tag = "GET_LINEEVENT"
+	if len(offsets) == 0 || len(offsets) > gpio.GPIOHANDLES_MAX {
+		return nil, errors.NotValidf("lines count=%d", len(offsets))
+	}
+	flag |= gpio.GPIOHANDLE_REQUEST_INPUT
+	if err := checkFlag(flag); err != nil {
+		return nil, err
+	}
+	switch opt.Clock {
+	case gpio.EventClockMonotonic, gpio.EventClockRealtime:
+	case gpio.EventClockHTE:
+		return nil, errors.NotSupportedf("Clock=%s by simulator", opt.Clock)
+	default:
+		return nil, errors.NotValidf("Clock=%d", opt.Clock)
+	}
+	if !c.incref() {
+		return nil, gpio.ErrClosed
+	}
+	d := c.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.request(offsets, flag, c.consumer(consumerLabel)); err != nil {
+		c.decref()
+		return nil, errors.Annotatef(err, "%s lines=%v", tag, offsets)
+	}
+	e := &event{
+		chip:      c,
+		offsets:   append([]uint32(nil), offsets...),
+		events:    events,
+		clock:     opt.Clock,
+		bufSize:   gpio.EventBufferSizeV2(opt.BufferSize, uint32(len(offsets))),
+		lineSeqno: make(map[uint32]uint32, len(offsets)),
+		ready:     make(chan struct{}, 1),
+		closing:   make(chan struct{}),
+	}
+	for _, o := range offsets {
+		d.lines[o].event = e
+	}
+	return e, nil
+}
+
+// One watcher per chip, like kernel watch state per chip fd.
+func (c *chip) WatchLineInfo(lines ...uint32) (gpio.LineWatcher, error) {
+	if !atomic.CompareAndSwapUint32(&c.watching, 0, 1) {
+		return nil, errors.AlreadyExistsf("WatchLineInfo chip=%s watcher", (&gpio.ChipEntry{Info: c.dev.info}).Name())
+	}
+	if !c.incref() {
+		atomic.StoreUint32(&c.watching, 0)
+		return nil, gpio.ErrClosed
+	}
+	w := &watcher{
+		chip:    c,
+		watched: make(map[uint32]struct{}, len(lines)),
+		ready:   make(chan struct{}, 1),
+		closing: make(chan struct{}),
+	}
+	c.dev.mu.Lock()
+	c.dev.watchers[w] = struct{}{}
+	c.dev.mu.Unlock()
+	for _, line := range lines {
+		if _, err := w.Watch(line); err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
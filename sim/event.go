@@ -0,0 +1,124 @@
+package sim
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/temoto/gpio-cdev-go"
+)
+
+type event struct {
+	chip    *chip
+	offsets []uint32
+	events  gpio.EventFlag
+	clock   gpio.EventClock
+	bufSize uint32
+
+	mu        sync.Mutex // guards queue and counters
+	queue     []gpio.Event
+	seqno     uint32
+	lineSeqno map[uint32]uint32
+	dropped   uint64
+
+	// signals new event to Wait, buffered 1
+	ready   chan struct{}
+	closing chan struct{}
+	closed  uint32
+}
+
+// compile-time interface check
+var _ gpio.Eventer = &event{}
+
+func (self *event) Close() error {
+	if atomic.AddUint32(&self.closed, 1) == 1 {
+		close(self.closing)
+		d := self.chip.dev
+		d.mu.Lock()
+		d.release(self.offsets)
+		d.mu.Unlock()
+		self.chip.decref()
+		return nil
+	}
+	return gpio.ErrClosed
+}
+
+// Returns value of first line.
+func (self *event) Read() (byte, error) {
+	if atomic.LoadUint32(&self.closed) != 0 {
+		return 0, gpio.ErrClosed
+	}
+	d := self.chip.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lines[self.offsets[0]].logical(), nil
+}
+
+// timeout=0 blocks forever, returns gpio.ErrTimeout same as gpio.Eventer.
+func (self *event) Wait(timeout time.Duration) (gpio.Event, error) {
+	timeoutCh, stop := after(timeout)
+	defer stop()
+	for {
+		self.mu.Lock()
+		if atomic.LoadUint32(&self.closed) != 0 {
+			self.mu.Unlock()
+			return gpio.Event{}, gpio.ErrClosed
+		}
+		if len(self.queue) != 0 {
+			e := self.queue[0]
+			self.queue = self.queue[1:]
+			self.mu.Unlock()
+			return e, nil
+		}
+		self.mu.Unlock()
+
+		select {
+		case <-self.ready:
+		case <-self.closing:
+		case <-timeoutCh:
+			return gpio.Event{}, gpio.ErrTimeout
+		}
+	}
+}
+
+// Counted when buffer overflows, like kernel drops oldest event.
+func (self *event) Dropped() uint64 { return atomic.LoadUint64(&self.dropped) }
+
+func (self *event) BufferSize() uint32 { return self.bufSize }
+
+// Called by Device with new logical value of line. Caller holds dev.mu.
+func (self *event) edge(offset uint32, value byte) {
+	e := gpio.Event{Clock: self.clock, LineOffset: offset}
+	if value != 0 {
+		if self.events&gpio.GPIOEVENT_REQUEST_RISING_EDGE == 0 {
+			return
+		}
+		e.ID = gpio.GPIOEVENT_EVENT_RISING_EDGE
+	} else {
+		if self.events&gpio.GPIOEVENT_REQUEST_FALLING_EDGE == 0 {
+			return
+		}
+		e.ID = gpio.GPIOEVENT_EVENT_FALLING_EDGE
+	}
+	if self.clock == gpio.EventClockRealtime {
+		e.Timestamp = uint64(time.Now().UnixNano())
+	} else {
+		e.Timestamp = gpio.MonotonicNow()
+	}
+
+	self.mu.Lock()
+	self.seqno++
+	self.lineSeqno[offset]++
+	e.Seqno, e.LineSeqno = self.seqno, self.lineSeqno[offset]
+	if uint32(len(self.queue)) >= self.bufSize {
+		self.queue = self.queue[1:]
+		atomic.AddUint64(&self.dropped, 1)
+	}
+	self.queue = append(self.queue, e)
+	self.mu.Unlock()
+
+	select {
+	case self.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,156 @@
+package sim
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+type lines struct {
+	chip    *chip
+	offsets []uint32
+	mu      sync.Mutex // guards values
+	values  [gpio.GPIOHANDLES_MAX]byte
+	closed  uint32
+}
+
+// compile-time interface check
+var _ gpio.Lineser = &lines{}
+
+func (self *lines) Close() error {
+	if atomic.AddUint32(&self.closed, 1) == 1 {
+		d := self.chip.dev
+		d.mu.Lock()
+		d.release(self.offsets)
+		d.mu.Unlock()
+		self.chip.decref()
+		return nil
+	}
+	return gpio.ErrClosed
+}
+
+func (self *lines) isClosed() bool { return atomic.LoadUint32(&self.closed) != 0 }
+
+// offset -> idx in self.offsets/values
+func (self *lines) mustFindLine(line uint32) int {
+	for i, l := range self.offsets {
+		if l == line {
+			return i
+		}
+	}
+	panic(fmt.Sprintf("code error invalid line=%d registered=%v", line, self.offsets))
+}
+
+func (self *lines) SetFunc(line uint32) gpio.LineSetFunc {
+	idx := self.mustFindLine(line)
+	return func(value byte) {
+		self.mu.Lock()
+		self.values[idx] = value
+		self.mu.Unlock()
+	}
+}
+
+func (self *lines) LineOffsets() []uint32 { return self.offsets }
+
+func (self *lines) Read() (gpio.HandleData, error) {
+	data := gpio.HandleData{}
+	if self.isClosed() {
+		return data, gpio.ErrClosed
+	}
+	d := self.chip.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, o := range self.offsets {
+		data.Values[i] = d.lines[o].logical()
+	}
+	return data, nil
+}
+
+func (self *lines) Flush() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.write(gpio.MaskAll(uint32(len(self.offsets))), gpio.ValuesToBits(self.values[:len(self.offsets)]))
+}
+
+// Drives masked output lines. Caller holds self.mu.
+func (self *lines) write(mask, bits uint64) error {
+	if self.isClosed() {
+		return gpio.ErrClosed
+	}
+	d := self.chip.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// kernel refuses to set values of input lines
+	if d.lines[self.offsets[0]].flag&gpio.GPIOHANDLE_REQUEST_OUTPUT == 0 {
+		return errno(syscall.EPERM)
+	}
+	for i, o := range self.offsets {
+		if mask&(1<<uint(i)) != 0 {
+			d.lines[o].setLogical(byte((bits >> uint(i)) & 1))
+		}
+	}
+	return nil
+}
+
+func (self *lines) SetBulk(bs ...byte) {
+	self.mu.Lock()
+	copy(self.values[:], bs)
+	self.mu.Unlock()
+}
+
+func (self *lines) GetValues(mask uint64) (uint64, error) {
+	mask &= gpio.MaskAll(uint32(len(self.offsets)))
+	data, err := self.Read()
+	return gpio.ValuesToBits(data.Values[:len(self.offsets)]) & mask, err
+}
+
+func (self *lines) SetValues(mask, bits uint64) error {
+	const tag = "SetValues"
+	mask &= gpio.MaskAll(uint32(len(self.offsets)))
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if err := self.write(mask, bits); err != nil {
+		return errors.Annotate(err, tag)
+	}
+	for i := range self.offsets {
+		if mask&(1<<uint(i)) != 0 {
+			self.values[i] = byte((bits >> uint(i)) & 1)
+		}
+	}
+	return nil
+}
+
+// Same semantics as gpio.Lineser.SetConfig: outputs are driven to
+// `defaultValues` or internal buffer, inputs refresh internal buffer.
+func (self *lines) SetConfig(flag gpio.RequestFlag, defaultValues ...byte) error {
+	if err := checkFlag(flag); err != nil {
+		return err
+	}
+	if self.isClosed() {
+		return gpio.ErrClosed
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	n := len(self.offsets)
+	if flag&gpio.GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		copy(self.values[:n], defaultValues)
+	}
+	d := self.chip.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, o := range self.offsets {
+		l := &d.lines[o]
+		l.flag = flag
+		if flag&gpio.GPIOHANDLE_REQUEST_OUTPUT != 0 {
+			l.setLogical(self.values[i])
+		} else {
+			self.values[i] = l.logical()
+		}
+		d.notify(o, gpio.GPIOLINE_CHANGED_CONFIG)
+	}
+	return nil
+}
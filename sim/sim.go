@@ -0,0 +1,217 @@
+// In-memory GPIO chip for tests, runs in plain `go test` without hardware.
+// Device models kernel side: line values, direction, active-low inversion,
+// drive and bias flags, consumer labels, EBUSY on double request, edge
+// events and line info changes. Device.Open returns gpio.Chiper with the
+// same ErrClosed and reference counting behaviour as gpio.Open.
+//
+//	dev := sim.New("gpiochip0", "test", "LED", "BUTTON")
+//	chip := dev.Open("app")      // pass to code under test instead of gpio.Open
+//	dev.Drive(1, 1)              // press button, produces rising edge
+//	dev.Level(0)                 // what code under test drives on LED
+//
+// Event timestamps use CLOCK_MONOTONIC like kernel, Event.Time works.
+// Debounce is accepted but has no effect, driven values are already clean.
+package sim
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+// Simulated chip, shared by all Chiper opened from it like device node.
+type Device struct {
+	mu       sync.Mutex
+	info     gpio.ChipInfo
+	lines    []line
+	watchers map[*watcher]struct{}
+}
+
+type line struct {
+	name     string
+	consumer string
+	used     bool
+	// flags of current or last request, only direction survives release
+	flag gpio.RequestFlag
+	// physical level, before active-low inversion
+	level byte
+	// event request of this line, if any
+	event *event
+}
+
+// Creates chip with one line per name, empty name is unnamed line.
+// All lines are free inputs at low level.
+func New(name, label string, lineNames ...string) *Device {
+	d := &Device{
+		lines:    make([]line, len(lineNames)),
+		watchers: make(map[*watcher]struct{}),
+	}
+	copy(d.info.Name[:], name)
+	copy(d.info.Label[:], label)
+	d.info.Lines = uint32(len(lineNames))
+	for i, n := range lineNames {
+		d.lines[i] = line{name: n, flag: gpio.GPIOHANDLE_REQUEST_INPUT}
+	}
+	return d
+}
+
+// Same as gpio.Open for this device.
+// You must call Chiper.Close()
+func (d *Device) Open(defaultConsumer string) gpio.Chiper {
+	return &chip{
+		dev:             d,
+		defaultConsumer: defaultConsumer,
+		refs:            1,
+		done:            make(chan struct{}),
+	}
+}
+
+// Sets physical level of line as external circuit would, like button press.
+// Produces edge event if line is requested for events. Fails for lines
+// requested as output, they are driven by owner.
+func (d *Device) Drive(offset uint32, level byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if offset >= d.info.Lines {
+		return errors.NotValidf("line=%d of %d", offset, d.info.Lines)
+	}
+	l := &d.lines[offset]
+	if l.used && l.flag&gpio.GPIOHANDLE_REQUEST_OUTPUT != 0 {
+		return errors.NotValidf("Drive line=%d requested as output by %s", offset, l.consumer)
+	}
+	if level != 0 {
+		level = 1
+	}
+	if l.level == level {
+		return nil
+	}
+	l.level = level
+	if l.event != nil {
+		l.event.edge(offset, l.logical())
+	}
+	return nil
+}
+
+// Returns physical level of line, what output drives or input was driven to.
+// Panics on invalid offset, like slice index.
+func (d *Device) Level(offset uint32) byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lines[offset].level
+}
+
+// Returns same info as LineInfo of any opened Chiper.
+func (d *Device) LineInfo(offset uint32) (gpio.LineInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lineInfo(offset)
+}
+
+func (d *Device) lineInfo(offset uint32) (gpio.LineInfo, error) {
+	li := gpio.LineInfo{LineOffset: offset}
+	if offset >= d.info.Lines {
+		return li, errno(syscall.EINVAL)
+	}
+	l := &d.lines[offset]
+	copy(li.Name[:], l.name)
+	copy(li.Consumer[:], l.consumer)
+	if l.used {
+		li.Flags |= gpio.GPIOLINE_FLAG_KERNEL
+	}
+	// v1 line info has no INPUT flag, same as kernel
+	li.Flags |= l.flag.V2().V1()
+	return li, nil
+}
+
+func (l *line) logical() byte {
+	if l.flag&gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW != 0 {
+		return l.level ^ 1
+	}
+	return l.level
+}
+
+func (l *line) setLogical(v byte) {
+	if v != 0 {
+		v = 1
+	}
+	if l.flag&gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW != 0 {
+		v ^= 1
+	}
+	l.level = v
+}
+
+// Marks lines used, all or nothing. Caller holds d.mu.
+func (d *Device) request(offsets []uint32, flag gpio.RequestFlag, consumer string) error {
+	if len(offsets) == 0 || len(offsets) > gpio.GPIOHANDLES_MAX {
+		return errno(syscall.EINVAL)
+	}
+	for i, o := range offsets {
+		if o >= d.info.Lines {
+			return errno(syscall.EINVAL)
+		}
+		if d.lines[o].used {
+			return errno(syscall.EBUSY)
+		}
+		for _, other := range offsets[:i] {
+			if other == o {
+				return errno(syscall.EBUSY)
+			}
+		}
+	}
+	for _, o := range offsets {
+		l := &d.lines[o]
+		l.used, l.consumer, l.flag = true, consumer, flag
+		d.notify(o, gpio.GPIOLINE_CHANGED_REQUESTED)
+	}
+	return nil
+}
+
+// Caller holds d.mu.
+func (d *Device) release(offsets []uint32) {
+	for _, o := range offsets {
+		l := &d.lines[o]
+		l.used, l.consumer, l.event = false, "", nil
+		l.flag &= gpio.GPIOHANDLE_REQUEST_INPUT | gpio.GPIOHANDLE_REQUEST_OUTPUT
+		d.notify(o, gpio.GPIOLINE_CHANGED_RELEASED)
+	}
+}
+
+// Caller holds d.mu.
+func (d *Device) notify(offset uint32, typ gpio.LineChangedType) {
+	if len(d.watchers) == 0 {
+		return
+	}
+	li, _ := d.lineInfo(offset)
+	e := gpio.LineInfoChanged{Info: li, Timestamp: gpio.MonotonicNow(), EventType: typ}
+	for w := range d.watchers {
+		w.push(e)
+	}
+}
+
+// Same error kernel returns from ioctl.
+func errno(e syscall.Errno) error { return os.NewSyscallError("SYS_IOCTL", e) }
+
+// Same validation as gpio.Chiper does before ioctl, then kernel checks.
+func checkFlag(f gpio.RequestFlag) error {
+	if err := f.Check(); err != nil {
+		return err
+	}
+	if f&(gpio.GPIOHANDLE_REQUEST_OPEN_DRAIN|gpio.GPIOHANDLE_REQUEST_OPEN_SOURCE) != 0 && f&gpio.GPIOHANDLE_REQUEST_OUTPUT == 0 {
+		// kernel rejects drive flags on inputs with EINVAL
+		return errno(syscall.EINVAL)
+	}
+	return nil
+}
+
+// Returns channel which fires after timeout, nil channel blocks forever for timeout=0.
+func after(timeout time.Duration) (<-chan time.Time, func()) {
+	if timeout == 0 {
+		return nil, func() {}
+	}
+	t := time.NewTimer(timeout)
+	return t.C, func() { t.Stop() }
+}
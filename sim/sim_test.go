@@ -0,0 +1,199 @@
+package sim
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+func isErrno(err error, e syscall.Errno) bool {
+	se, ok := errors.Cause(err).(*os.SyscallError)
+	return ok && se.Err == e
+}
+
+func TestLines(t *testing.T) {
+	dev := New("gpiochip0", "test", "LED", "BUTTON", "")
+	chip := dev.Open("app")
+	defer chip.Close()
+
+	offsets, err := chip.FindLines("BUTTON", "LED")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 0}, offsets)
+	_, err = chip.FindLines("")
+	assert.True(t, errors.IsNotFound(err), errors.ErrorStack(err))
+	_, err = chip.FindLines("LED", "LED")
+	assert.True(t, errors.IsNotValid(err), "same rules as gpio chip err=%v", err)
+
+	led, err := chip.OpenLinesWith(gpio.GPIOHANDLE_REQUEST_OUTPUT|gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW, "",
+		gpio.LineOptions{DefaultValues: []byte{1}}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), dev.Level(0), "active-low default value")
+	li, err := chip.LineInfo(0)
+	require.NoError(t, err)
+	assert.Equal(t, "app", li.ConsumerString())
+	assert.Equal(t, gpio.GPIOLINE_FLAG_KERNEL|gpio.GPIOLINE_FLAG_IS_OUT|gpio.GPIOLINE_FLAG_ACTIVE_LOW, li.Flags)
+
+	_, err = chip.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT, "other", 0)
+	assert.True(t, isErrno(err, syscall.EBUSY), errors.ErrorStack(err))
+	_, err = chip.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT, "", 1, 1)
+	assert.True(t, isErrno(err, syscall.EBUSY), errors.ErrorStack(err))
+	_, err = chip.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT, "", 3)
+	assert.True(t, isErrno(err, syscall.EINVAL), errors.ErrorStack(err))
+	assert.Error(t, dev.Drive(0, 1), "output is driven by owner")
+
+	led.SetFunc(0)(0)
+	require.NoError(t, led.Flush())
+	assert.Equal(t, byte(1), dev.Level(0))
+	require.NoError(t, led.SetValues(1, 1))
+	assert.Equal(t, byte(0), dev.Level(0))
+	bits, err := led.GetValues(1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), bits)
+
+	require.NoError(t, led.SetConfig(gpio.GPIOHANDLE_REQUEST_INPUT))
+	require.NoError(t, dev.Drive(0, 1))
+	data, err := led.Read()
+	require.NoError(t, err)
+	assert.Equal(t, byte(1), data.Values[0], "active-low dropped by SetConfig")
+	assert.True(t, isErrno(led.Flush(), syscall.EPERM))
+
+	require.NoError(t, led.Close())
+	assert.Equal(t, gpio.ErrClosed, led.Close())
+	_, err = led.Read()
+	assert.Equal(t, gpio.ErrClosed, err)
+	li, err = chip.LineInfo(0)
+	require.NoError(t, err)
+	assert.Equal(t, gpio.LineFlag(0), li.Flags)
+	assert.Equal(t, "", li.ConsumerString())
+
+	states, err := chip.Snapshot()
+	require.NoError(t, err)
+	assert.Len(t, states, 3)
+	assert.Equal(t, "BUTTON", states[1].Name)
+}
+
+func TestEvent(t *testing.T) {
+	dev := New("gpiochip0", "test", "A", "B")
+	chip := dev.Open("app")
+	defer chip.Close()
+
+	ev, err := chip.GetLinesEvent([]uint32{0, 1}, gpio.GPIOHANDLE_REQUEST_ACTIVE_LOW, gpio.GPIOEVENT_REQUEST_BOTH_EDGES, "", gpio.EventOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(32), ev.BufferSize())
+	v, err := ev.Read()
+	require.NoError(t, err)
+	assert.Equal(t, byte(1), v)
+
+	_, err = ev.Wait(time.Millisecond)
+	assert.Equal(t, gpio.ErrTimeout, err)
+
+	require.NoError(t, dev.Drive(1, 1))
+	e, err := ev.Wait(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, gpio.EventID(gpio.GPIOEVENT_EVENT_FALLING_EDGE), e.ID, "active-low")
+	assert.Equal(t, uint32(1), e.LineOffset)
+	assert.Equal(t, uint32(1), e.Seqno)
+	assert.WithinDuration(t, time.Now(), e.Time(), time.Second)
+
+	// blocked Wait is woken by Drive from another goroutine
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = dev.Drive(0, 1)
+	}()
+	e, err = ev.Wait(0)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), e.LineOffset)
+	assert.Equal(t, uint32(2), e.Seqno)
+	assert.Equal(t, uint32(1), e.LineSeqno)
+
+	require.NoError(t, ev.Close())
+	_, err = ev.Wait(time.Second)
+	assert.Equal(t, gpio.ErrClosed, err)
+	require.NoError(t, dev.Drive(0, 0), "released line may be driven")
+}
+
+func TestEventOverflow(t *testing.T) {
+	dev := New("gpiochip0", "test", "A")
+	chip := dev.Open("app")
+	defer chip.Close()
+	ev, err := chip.GetLineEventWith(0, 0, gpio.GPIOEVENT_REQUEST_RISING_EDGE, "", gpio.EventOptions{BufferSize: 2})
+	require.NoError(t, err)
+	defer ev.Close()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, dev.Drive(0, 1))
+		require.NoError(t, dev.Drive(0, 0))
+	}
+	assert.Equal(t, uint64(2), ev.Dropped())
+	e, err := ev.Wait(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), e.Seqno, "oldest dropped, falling edges not counted")
+}
+
+func TestChipClose(t *testing.T) {
+	dev := New("gpiochip0", "test", "A")
+	chip := dev.Open("app")
+	lines, err := chip.OpenLines(gpio.GPIOHANDLE_REQUEST_OUTPUT, "", 0)
+	require.NoError(t, err)
+
+	closed := make(chan error)
+	go func() { closed <- chip.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("chip.Close must wait for lines")
+	case <-time.After(20 * time.Millisecond):
+	}
+	_, err = chip.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT, "", 0)
+	assert.Equal(t, gpio.ErrClosed, err)
+	require.NoError(t, lines.Close())
+	require.NoError(t, <-closed)
+	assert.Equal(t, gpio.ErrClosed, chip.Close())
+
+	// device outlives chip, like kernel
+	chip = dev.Open("again")
+	defer chip.Close()
+	lines, err = chip.OpenLines(gpio.GPIOHANDLE_REQUEST_OUTPUT, "", 0)
+	require.NoError(t, err)
+	require.NoError(t, lines.Close())
+}
+
+func TestWatch(t *testing.T) {
+	dev := New("gpiochip0", "test", "A", "B")
+	chip := dev.Open("app")
+	defer chip.Close()
+	w, err := chip.WatchLineInfo(1)
+	require.NoError(t, err)
+	_, err = chip.WatchLineInfo()
+	assert.True(t, errors.IsAlreadyExists(err), errors.ErrorStack(err))
+	_, err = w.Watch(1)
+	assert.True(t, isErrno(err, syscall.EBUSY), errors.ErrorStack(err))
+
+	other := dev.Open("other")
+	l0, err := other.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT, "", 0)
+	require.NoError(t, err)
+	l1, err := other.OpenLines(gpio.GPIOHANDLE_REQUEST_INPUT, "", 1)
+	require.NoError(t, err)
+	require.NoError(t, l1.SetConfig(gpio.GPIOHANDLE_REQUEST_OUTPUT))
+	require.NoError(t, l0.Close())
+	require.NoError(t, l1.Close())
+	require.NoError(t, other.Close())
+
+	for _, expect := range []gpio.LineChangedType{gpio.GPIOLINE_CHANGED_REQUESTED, gpio.GPIOLINE_CHANGED_CONFIG, gpio.GPIOLINE_CHANGED_RELEASED} {
+		e, err := w.Wait(time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(1), e.Info.LineOffset)
+		assert.Equal(t, expect, e.EventType)
+	}
+	_, err = w.Wait(time.Millisecond)
+	assert.Equal(t, gpio.ErrTimeout, err)
+
+	require.NoError(t, w.Close())
+	w, err = chip.WatchLineInfo()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
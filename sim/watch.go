@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/temoto/gpio-cdev-go"
+)
+
+// kernel lineinfo kfifo size, further changes are dropped until read
+const watchBufferSize = 32
+
+type watcher struct {
+	chip    *chip
+	mu      sync.Mutex // guards watched and queue
+	watched map[uint32]struct{}
+	queue   []gpio.LineInfoChanged
+
+	// signals new change to Wait, buffered 1
+	ready   chan struct{}
+	closing chan struct{}
+	closed  uint32
+}
+
+// compile-time interface check
+var _ gpio.LineWatcher = &watcher{}
+
+func (self *watcher) Close() error {
+	if atomic.AddUint32(&self.closed, 1) == 1 {
+		close(self.closing)
+		d := self.chip.dev
+		d.mu.Lock()
+		delete(d.watchers, self)
+		d.mu.Unlock()
+		self.chip.decref()
+		atomic.StoreUint32(&self.chip.watching, 0)
+		return nil
+	}
+	return gpio.ErrClosed
+}
+
+// Watching already watched line is EBUSY, same as kernel.
+func (self *watcher) Watch(line uint32) (gpio.LineInfo, error) {
+	const tag = "GET_LINEINFO_WATCH"
+	if atomic.LoadUint32(&self.closed) != 0 {
+		return gpio.LineInfo{}, gpio.ErrClosed
+	}
+	d := self.chip.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	li, err := d.lineInfo(line)
+	if err != nil {
+		return li, errors.Annotatef(err, "%s line=%d", tag, line)
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, ok := self.watched[line]; ok {
+		return li, errors.Annotatef(errno(syscall.EBUSY), "%s line=%d", tag, line)
+	}
+	self.watched[line] = struct{}{}
+	return li, nil
+}
+
+func (self *watcher) Unwatch(line uint32) error {
+	const tag = "GET_LINEINFO_UNWATCH"
+	if atomic.LoadUint32(&self.closed) != 0 {
+		return gpio.ErrClosed
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, ok := self.watched[line]; !ok {
+		return errors.Annotatef(errno(syscall.EBUSY), "%s line=%d", tag, line)
+	}
+	delete(self.watched, line)
+	return nil
+}
+
+// timeout=0 blocks forever, returns gpio.ErrTimeout same as gpio.LineWatcher.
+func (self *watcher) Wait(timeout time.Duration) (gpio.LineInfoChanged, error) {
+	timeoutCh, stop := after(timeout)
+	defer stop()
+	for {
+		self.mu.Lock()
+		if atomic.LoadUint32(&self.closed) != 0 {
+			self.mu.Unlock()
+			return gpio.LineInfoChanged{}, gpio.ErrClosed
+		}
+		if len(self.queue) != 0 {
+			e := self.queue[0]
+			self.queue = self.queue[1:]
+			self.mu.Unlock()
+			return e, nil
+		}
+		self.mu.Unlock()
+
+		select {
+		case <-self.ready:
+		case <-self.closing:
+		case <-timeoutCh:
+			return gpio.LineInfoChanged{}, gpio.ErrTimeout
+		}
+	}
+}
+
+// Called by Device on change of any line. Caller holds dev.mu.
+func (self *watcher) push(e gpio.LineInfoChanged) {
+	self.mu.Lock()
+	_, ok := self.watched[e.Info.LineOffset]
+	if ok && len(self.queue) < watchBufferSize {
+		self.queue = append(self.queue, e)
+	}
+	self.mu.Unlock()
+	if ok {
+		select {
+		case self.ready <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package gpio
+
+import (
+	"sort"
+
+	"github.com/juju/errors"
+)
+
+// Decoded LineInfo, friendly to print and marshal.
+type LineState struct {
+	Offset   uint32 `json:"offset"`
+	Name     string `json:"name"`
+	Consumer string `json:"consumer"`
+	// requested by kernel or any process, line is free when false
+	Used bool `json:"used"`
+	// "input" or "output"
+	Direction string `json:"direction"`
+	ActiveLow bool   `json:"active_low"`
+	// "push-pull", "open-drain" or "open-source"
+	Drive string `json:"drive"`
+	// see LineInfo.Bias
+	Bias  string   `json:"bias"`
+	Flags LineFlag `json:"flags"`
+}
+
+func (li *LineInfo) State() LineState {
+	s := LineState{
+		Offset:    li.LineOffset,
+		Name:      li.NameString(),
+		Consumer:  li.ConsumerString(),
+		Used:      li.Flags&GPIOLINE_FLAG_KERNEL != 0,
+		Direction: "input",
+		ActiveLow: li.Flags&GPIOLINE_FLAG_ACTIVE_LOW != 0,
+		Drive:     "push-pull",
+		Bias:      li.Bias(),
+		Flags:     li.Flags,
+	}
+	if li.Flags&GPIOLINE_FLAG_IS_OUT != 0 {
+		s.Direction = "output"
+	}
+	switch {
+	case li.Flags&GPIOLINE_FLAG_OPEN_DRAIN != 0:
+		s.Drive = "open-drain"
+	case li.Flags&GPIOLINE_FLAG_OPEN_SOURCE != 0:
+		s.Drive = "open-source"
+	}
+	return s
+}
+
+// Returns state of every line of chip, indexed by offset.
+// Makes LineInfo syscall for each line, so it is not atomic:
+// lines may change while snapshot is taken.
+func (c *chip) Snapshot() ([]LineState, error) { return ChipSnapshot(c) }
+
+// Snapshot of any Chiper from its Info and LineInfo, for Chiper implementations.
+func ChipSnapshot(c Chiper) ([]LineState, error) {
+	states := make([]LineState, c.Info().Lines)
+	for i := range states {
+		li, err := c.LineInfo(uint32(i))
+		if err != nil {
+			return nil, errors.Annotatef(err, "Snapshot line=%d", i)
+		}
+		states[i] = li.State()
+	}
+	return states, nil
+}
+
+// Difference of one line between two snapshots.
+// Before or After is nil if line is missing in respective snapshot.
+type LineChange struct {
+	Offset uint32     `json:"offset"`
+	Before *LineState `json:"before"`
+	After  *LineState `json:"after"`
+	// names of changed LineState fields, like "Consumer", "Direction"
+	Fields []string `json:"fields"`
+}
+
+// Returns changed lines ordered by offset, matched by LineState.Offset.
+func DiffSnapshots(before, after []LineState) []LineChange {
+	bm := make(map[uint32]*LineState, len(before))
+	for i := range before {
+		bm[before[i].Offset] = &before[i]
+	}
+	var changes []LineChange
+	seen := make(map[uint32]bool, len(after))
+	for i := range after {
+		a := &after[i]
+		seen[a.Offset] = true
+		b, ok := bm[a.Offset]
+		if !ok {
+			changes = append(changes, LineChange{Offset: a.Offset, After: a})
+			continue
+		}
+		if fields := diffLineState(b, a); len(fields) != 0 {
+			changes = append(changes, LineChange{Offset: a.Offset, Before: b, After: a, Fields: fields})
+		}
+	}
+	for i := range before {
+		if b := &before[i]; !seen[b.Offset] {
+			changes = append(changes, LineChange{Offset: b.Offset, Before: b})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Offset < changes[j].Offset })
+	return changes
+}
+
+func diffLineState(a, b *LineState) []string {
+	var fields []string
+	if a.Name != b.Name {
+		fields = append(fields, "Name")
+	}
+	if a.Consumer != b.Consumer {
+		fields = append(fields, "Consumer")
+	}
+	if a.Used != b.Used {
+		fields = append(fields, "Used")
+	}
+	if a.Direction != b.Direction {
+		fields = append(fields, "Direction")
+	}
+	if a.ActiveLow != b.ActiveLow {
+		fields = append(fields, "ActiveLow")
+	}
+	if a.Drive != b.Drive {
+		fields = append(fields, "Drive")
+	}
+	if a.Bias != b.Bias {
+		fields = append(fields, "Bias")
+	}
+	return fields
+}
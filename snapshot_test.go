@@ -0,0 +1,48 @@
+package gpio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineInfoState(t *testing.T) {
+	li := LineInfo{LineOffset: 4, Flags: GPIOLINE_FLAG_KERNEL | GPIOLINE_FLAG_IS_OUT | GPIOLINE_FLAG_OPEN_DRAIN | GPIOLINE_FLAG_BIAS_PULL_UP}
+	copy(li.Name[:], "GPIO4")
+	copy(li.Consumer[:], "relay")
+	s := li.State()
+	assert.Equal(t, LineState{
+		Offset: 4, Name: "GPIO4", Consumer: "relay", Used: true, Direction: "output",
+		Drive: "open-drain", Bias: "pull-up", Flags: li.Flags,
+	}, s)
+
+	free := LineInfo{LineOffset: 5}
+	s = free.State()
+	assert.False(t, s.Used)
+	assert.Equal(t, "input", s.Direction)
+	assert.Equal(t, "push-pull", s.Drive)
+	assert.Equal(t, "unknown", s.Bias)
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := []LineState{
+		{Offset: 0, Name: "A"},
+		{Offset: 1, Name: "B"},
+		{Offset: 2, Name: "C"},
+	}
+	after := []LineState{
+		{Offset: 2, Name: "C", Used: true, Consumer: "x", Direction: "output"},
+		{Offset: 0, Name: "A"},
+		{Offset: 3, Name: "D"},
+	}
+	changes := DiffSnapshots(before, after)
+	if assert.Len(t, changes, 3) {
+		assert.Equal(t, uint32(1), changes[0].Offset)
+		assert.Nil(t, changes[0].After)
+		assert.Equal(t, uint32(2), changes[1].Offset)
+		assert.Equal(t, []string{"Consumer", "Used", "Direction"}, changes[1].Fields)
+		assert.Equal(t, uint32(3), changes[2].Offset)
+		assert.Nil(t, changes[2].Before)
+	}
+	assert.Empty(t, DiffSnapshots(before, before))
+}
@@ -0,0 +1,208 @@
+package gpio
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/juju/errors"
+)
+
+// Starts watching for line request, release and config changes made by
+// anyone, including other processes. Linux 5.7+
+// Kernel keeps watch state per chip fd, so there may be only one active
+// LineWatcher per Chiper. Initial lines may be empty, use Watch() later.
+func (c *chip) WatchLineInfo(lines ...uint32) (LineWatcher, error) {
+	const tag = "WatchLineInfo"
+	if !atomic.CompareAndSwapUint32(&c.watching, 0, 1) {
+		return nil, errors.AlreadyExistsf("%s chip=%s watcher", tag, cstr(c.info.Name[:]))
+	}
+	if !c.fa.incref() {
+		atomic.StoreUint32(&c.watching, 0)
+		return nil, ErrClosed
+	}
+
+	// dup shares open file description, so watches on either fd are same,
+	// but watcher may close its own fd without affecting chip
+	fd, err := syscall.Dup(c.fa.fd)
+	if err != nil {
+		c.fa.decref()
+		atomic.StoreUint32(&c.watching, 0)
+		return nil, errors.Annotate(err, tag+" dup")
+	}
+	syscall.CloseOnExec(fd)
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		_ = syscall.Close(fd)
+		c.fa.decref()
+		atomic.StoreUint32(&c.watching, 0)
+		return nil, errors.Annotate(err, tag+" SetNonblock")
+	}
+
+	w := &lineWatcher{
+		chip:    c,
+		f:       os.NewFile(uintptr(fd), fmt.Sprintf("gpio:watch:%s", cstr(c.info.Name[:]))),
+		watched: make(map[uint32]struct{}, len(lines)),
+	}
+	for _, line := range lines {
+		if _, err = w.Watch(line); err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+type lineWatcher struct {
+	chip    *chip
+	f       *os.File
+	mu      sync.Mutex // guards watched and chip fd use, watched=nil after Close
+	watched map[uint32]struct{}
+	closed  uint32
+}
+
+// Close unwatches all lines and releases chip reference.
+func (self *lineWatcher) Close() error {
+	if atomic.AddUint32(&self.closed, 1) == 1 {
+		self.mu.Lock()
+		for line := range self.watched {
+			_ = RawUnwatchLineInfo(self.chip.fa.fd, line)
+		}
+		self.watched = nil
+		self.mu.Unlock()
+		err := self.f.Close()
+		self.chip.fa.decref()
+		atomic.StoreUint32(&self.chip.watching, 0)
+		return err
+	}
+	return ErrClosed
+}
+
+// Adds line to watch set and returns its current info.
+func (self *lineWatcher) Watch(line uint32) (LineInfo, error) {
+	const tag = "GET_LINEINFO_WATCH"
+	// mu held across ioctl: Close releases chip fd only after watched=nil
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.watched == nil {
+		return LineInfo{}, ErrClosed
+	}
+	var li LineInfo
+	var err error
+	if self.chip.v2 {
+		li2 := LineInfoV2{Offset: line}
+		err = RawWatchLineInfoV2(self.chip.fa.fd, &li2)
+		li = li2.LineInfo()
+	} else {
+		li.LineOffset = line
+		err = RawWatchLineInfo(self.chip.fa.fd, &li)
+	}
+	if err != nil {
+		return li, errors.Annotatef(err, "%s line=%d", tag, line)
+	}
+	self.watched[line] = struct{}{}
+	return li, nil
+}
+
+func (self *lineWatcher) Unwatch(line uint32) error {
+	const tag = "GET_LINEINFO_UNWATCH"
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.watched == nil {
+		return ErrClosed
+	}
+	if err := RawUnwatchLineInfo(self.chip.fa.fd, line); err != nil {
+		return errors.Annotatef(err, "%s line=%d", tag, line)
+	}
+	delete(self.watched, line)
+	return nil
+}
+
+// Waits for next change of any watched line.
+// timeout=0 blocks forever, returns ErrTimeout same as Eventer.Wait.
+func (self *lineWatcher) Wait(timeout time.Duration) (LineInfoChanged, error) {
+	const tag = "watch.Wait"
+	var deadline time.Time
+	var e LineInfoChanged
+	if timeout != 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := self.f.SetDeadline(deadline); err != nil {
+		return e, errors.Annotate(err, tag)
+	}
+	var err error
+	if self.chip.v2 {
+		e, err = self.readChangeV2()
+	} else {
+		e, err = self.readChange()
+	}
+	// specifically don't annotate timeout, to ease external code checks
+	if err == ErrTimeout {
+		return e, err
+	}
+	if err != nil {
+		err = errors.Annotate(err, tag)
+	}
+	return e, err
+}
+
+func (self *lineWatcher) readChange() (LineInfoChanged, error) {
+	const esz = int(unsafe.Sizeof(LineInfoChanged{}))
+	type eventBuf [esz]byte
+	var buf eventBuf
+	var e LineInfoChanged
+	if err := readFixed(self.f, buf[:]); err != nil {
+		return e, err
+	}
+	eb := (*eventBuf)(unsafe.Pointer(&e))
+	copy((*eb)[:], buf[:])
+	return e, nil
+}
+
+func (self *lineWatcher) readChangeV2() (LineInfoChanged, error) {
+	const esz = int(unsafe.Sizeof(LineInfoChangedV2{}))
+	type eventBuf [esz]byte
+	var buf eventBuf
+	var e2 LineInfoChangedV2
+	if err := readFixed(self.f, buf[:]); err != nil {
+		return LineInfoChanged{}, err
+	}
+	eb := (*eventBuf)(unsafe.Pointer(&e2))
+	copy((*eb)[:], buf[:])
+	e := LineInfoChanged{
+		Info:      e2.Info.LineInfo(),
+		Timestamp: e2.TimestampNs,
+		EventType: e2.EventType,
+	}
+	return e, nil
+}
+
+// Reads exactly one kernel event record into buf.
+func readFixed(f *os.File, buf []byte) error {
+	n, err := f.Read(buf)
+	if IsTimeout(err) {
+		return ErrTimeout
+	}
+	if err != nil {
+		return err
+	}
+	if n != len(buf) {
+		return errors.Errorf("readEvent fail n=%d expected=%d", n, len(buf))
+	}
+	return nil
+}
+
+func (t LineChangedType) String() string {
+	switch t {
+	case GPIOLINE_CHANGED_REQUESTED:
+		return "requested"
+	case GPIOLINE_CHANGED_RELEASED:
+		return "released"
+	case GPIOLINE_CHANGED_CONFIG:
+		return "config-changed"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(t))
+}